@@ -1,44 +1,279 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"library-app/internal/auth"
+	"library-app/internal/clock"
+	"library-app/internal/config"
+	"library-app/internal/dto"
+	"library-app/internal/email"
 	"library-app/internal/handlers"
+	"library-app/internal/models"
+	"library-app/internal/policy"
 	"library-app/internal/services"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	_ "modernc.org/sqlite"
 )
 
 func main() {
-	library := services.NewLibrary()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Ошибка настроек: %v", err)
+	}
 
-	author1ID := library.AddAuthor("Лев Толстой", "tolstoy@mail.ru", "Русский писатель")
-	author2ID := library.AddAuthor("Фёдор Достоевский", "dostoevsky@mail.ru", "Русский писатель")
-	author3ID := library.AddAuthor("Антон Чехов", "chekhov@mail.ru", "Русский писатель и драматург")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	library.AddBook("Война и мир", author1ID, 1869)
-	library.AddBook("Анна Каренина", author1ID, 1877)
-	library.AddBook("Преступление и наказание", author2ID, 1866)
-	library.AddBook("Братья Карамазовы", author2ID, 1880)
-	library.AddBook("Вишневый сад", author3ID, 1904)
-	library.AddBook("Чайка", author3ID, 1896)
+	repo, err := openRepository(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Ошибка открытия хранилища: %v", err)
+	}
 
-	library.StartExpirationChecker()
+	mailer, err := email.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Ошибка настройки почты: %v", err)
+	}
+
+	library := services.NewLibrary(repo, services.Options{
+		Mailer:             mailer,
+		EmailWorkers:       cfg.Notifications.Workers,
+		EmailQueue:         cfg.Notifications.QueueSize,
+		ReservationWorkers: cfg.Reservations.Workers,
+		ReservationQueue:   cfg.Reservations.QueueSize,
+		Retry: services.RetryPolicy{
+			MaxAttempts: cfg.Notifications.MaxAttempts,
+			BaseDelay:   cfg.Notifications.RetryBaseDelay,
+			MaxDelay:    cfg.Notifications.RetryMaxDelay,
+		},
+		EmailClaimTimeout: cfg.Notifications.ClaimTimeout,
+		WebhookTimeout:    cfg.Webhooks.Timeout,
+		WebhookRetry: services.RetryPolicy{
+			MaxAttempts: cfg.Webhooks.MaxAttempts,
+			BaseDelay:   cfg.Webhooks.RetryBaseDelay,
+			MaxDelay:    cfg.Webhooks.RetryMaxDelay,
+		},
+	})
 
-	router := handlers.SetupRouter(library)
+	if cfg.Dev.TimeTravel {
+		fmt.Println("⚠️  Включены симулированные часы (dev.time_travel), не используйте в проде")
+		library.Clock = clock.NewSimulated()
+	}
+
+	library.Policy, err = policy.LoadEngine(cfg.Circulation.Policy)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки правил выдачи: %v", err)
+	}
+	library.Templates, err = templates.Load(cfg.Mail.Templates)
+	if err != nil {
+		log.Fatalf("Ошибка загрузки шаблонов писем: %v", err)
+	}
+	watchReload(library.Policy, library.Templates)
+
+	if cfg.Auth.Secret == "" {
+		fmt.Println("⚠️  Ключ подписи токенов не задан, токены и ссылки отписки перестанут действовать после перезапуска")
+		cfg.Auth.Secret = auth.RandomSecret()
+	}
+	signer := auth.NewSigner(cfg.Auth.Secret, cfg.Auth.TokenTTL)
+	library.UnsubscribeLink = func(email, event string) string {
+		return strings.TrimSuffix(cfg.Mail.BaseURL, "/") + "/unsubscribe?token=" + signer.UnsubscribeToken(email, event)
+	}
+
+	if library.IsEmpty() {
+		seedLibrary(library, cfg.Dev.DemoAccounts)
+	}
+
+	// Первый администратор задаётся в настройках
+	if cfg.Auth.AdminEmail != "" {
+		if err := library.EnsureAdmin(cfg.Auth.AdminEmail, cfg.Auth.AdminPassword); err != nil {
+			log.Fatalf("Не удалось создать администратора: %v", err)
+		}
+	}
+
+	if len(library.GetStaffAccounts()) == 0 {
+		fmt.Println("⚠️  Нет ни одного сотрудника: задайте auth.admin_email и auth.admin_password (LIBRARY_ADMIN_EMAIL, LIBRARY_ADMIN_PASSWORD)")
+	}
 
-	fmt.Println("🚀 Сервер библиотеки запущен на http://localhost:8080")
+	library.StartExpirationChecker(ctx, cfg.Circulation.ExpirationInterval)
+	library.StartOutboxDispatcher(ctx, cfg.Notifications.RetryInterval)
+	library.StartWebhookDispatcher(ctx, cfg.Webhooks.RetryInterval)
+
+	router := handlers.SetupRouter(library, signer, cfg)
+
+	fmt.Printf("🚀 Сервер библиотеки запущен на %s\n", cfg.Server.Addr)
 	fmt.Println("📚 Доступные endpoints:")
 	fmt.Println("   GET  /health          - Проверка здоровья API")
+	fmt.Println("   POST /auth/login      - Вход, возвращает токен (Authorization: Bearer <токен>)")
+	fmt.Println("   GET  /auth/me         - Текущий читатель")
+	fmt.Println("   POST /auth/password   - Сменить пароль")
 	fmt.Println("   GET  /books           - Все книги")
 	fmt.Println("   GET  /books/:id       - Конкретная книга")
 	fmt.Println("   POST /books           - Добавить книгу")
 	fmt.Println("   POST /books/:id/reserve - Забронировать книгу")
+	fmt.Println("   GET  /books/:id/waitlist - Очередь на книгу (читателю - длина и своё место)")
+	fmt.Println("   POST /books/:id/waitlist - Встать в очередь")
+	fmt.Println("   POST /books/:id/checkout - Выдать книгу")
+	fmt.Println("   POST /books/:id/return - Вернуть книгу")
+	fmt.Println("   GET  /books/:id/copies - Экземпляры книги")
+	fmt.Println("   POST /books/:id/copies - Добавить экземпляр")
 	fmt.Println("   GET  /authors         - Все авторы")
 	fmt.Println("   POST /authors         - Добавить автора")
-	fmt.Println("   GET  /reservations    - Брони пользователя (user_email параметр)")
+	fmt.Println("   GET  /reservations    - Брони текущего читателя")
 	fmt.Println("   POST /reservations/:id/cancel - Отменить бронь")
+	fmt.Println("   POST /reservations/:id/renew - Продлить бронь")
+	fmt.Println("   GET  /loans           - Выдачи текущего читателя")
+	fmt.Println("   POST /loans/:id/renew - Продлить выдачу")
+	fmt.Println("   GET  /patrons         - Читатели (card - поиск по номеру билета)")
+	fmt.Println("   POST /patrons         - Зарегистрировать читателя")
+	fmt.Println("   GET  /patrons/:email  - Данные читателя")
+	fmt.Println("   PUT  /patrons/:email  - Изменить данные читателя")
+	fmt.Println("   POST /patrons/:email/deactivate - Заблокировать билет")
+	fmt.Println("   GET  /patrons/:email/fines - Штрафы и баланс читателя")
+	fmt.Println("   GET  /patrons/:email/notifications - Настройки писем читателя")
+	fmt.Println("   PUT  /patrons/:email/notifications - Изменить настройки писем")
+	fmt.Println("   POST /fines/:id/pay   - Оплатить штраф (amount в копейках)")
+	fmt.Println("   POST /fines/:id/waive - Списать штраф")
+	fmt.Println("   GET  /config          - Действующие настройки (без секретов)")
+	fmt.Println("   GET  /events          - Счётчики доменных событий")
+	fmt.Println("   GET  /policy          - Действующие правила выдачи")
+	fmt.Println("   POST /policy/reload   - Перечитать файл правил")
+	fmt.Println("   GET  /notifications/templates - События и языки писем")
+	fmt.Println("   GET  /notifications/preview - Предпросмотр письма (event, lang)")
+	fmt.Println("   POST /notifications/templates/reload - Перечитать шаблоны писем")
+	fmt.Println("   GET  /notifications/dead - Недоставленные письма")
+	fmt.Println("   GET  /notifications/:id - Состояние доставки письма")
+	fmt.Println("   POST /notifications/:id/requeue - Повторить недоставленное письмо")
+	fmt.Println("   GET  /unsubscribe?token= - Подтверждение отписки по ссылке из письма")
+	fmt.Println("   POST /unsubscribe?token= - Отписка (форма или письмо в один клик), без входа")
+	fmt.Println("   GET  /webhooks/ - Подписки на события (POST - создать)")
+	fmt.Println("   PUT  /webhooks/:id - Изменить подписку (DELETE - удалить)")
+	fmt.Println("   POST /webhooks/:id/ping - Проверочная доставка")
+	fmt.Println("   GET  /webhooks/:id/deliveries - Журнал доставок")
+	fmt.Println("   POST /webhooks/:id/deliveries/:delivery/redeliver - Повторить доставку")
+	fmt.Println("   GET  /staff           - Сотрудники")
+	fmt.Println("   POST /staff           - Добавить сотрудника")
+	fmt.Println("   PUT  /staff/:email/role - Сменить роль")
+	fmt.Println("   GET  /apikeys         - API-ключи (передаются в заголовке X-API-Key)")
+	fmt.Println("   POST /apikeys         - Создать API-ключ")
+	fmt.Println("   POST /apikeys/:id/revoke - Отозвать API-ключ")
 	fmt.Println("   GET  /search/books    - Поиск книг")
+	if cfg.Dev.TimeTravel {
+		fmt.Println("   GET  /dev/clock       - Текущее симулированное время")
+		fmt.Println("   POST /dev/clock/advance - Перевести часы и обработать просрочки")
+		fmt.Println("   POST /dev/expirations/run - Обработать просрочки")
+	}
+
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Ошибка запуска сервера: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	fmt.Printf("Остановка сервера (не дольше %s)...\n", cfg.Server.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Сначала перестаём принимать запросы, затем разбираем очереди
+	// и только потом сохраняем состояние
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Не все запросы завершились: %v\n", err)
+	}
+	if err := library.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Фоновые задачи остановлены не полностью: %v\n", err)
+	}
+	if err := repo.Close(); err != nil {
+		log.Fatalf("Не удалось сохранить состояние: %v", err)
+	}
+	fmt.Println("Сервер остановлен")
+}
+
+func openRepository(cfg config.Storage) (storage.Repository, error) {
+	switch cfg.Kind {
+	case "memory":
+		return storage.NewMemoryStore(), nil
+	case "json":
+		return storage.NewJSONFileStore(cfg.Data)
+	case "journal":
+		store, err := storage.NewJournalStore(cfg.Data, cfg.Journal)
+		if err != nil {
+			return nil, err
+		}
+		store.StartCompaction(cfg.CompactInterval)
+		return store, nil
+	case "sqlite":
+		db, err := sql.Open("sqlite", cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewSQLStore(db)
+	default:
+		return nil, fmt.Errorf("неизвестный тип хранилища %q", cfg.Kind)
+	}
+}
+
+// watchReload перечитывает правила выдачи и шаблоны писем по сигналу SIGHUP.
+func watchReload(engine *policy.Engine, messages *templates.Set) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := engine.Reload(); err != nil {
+				fmt.Printf("Правила выдачи не перечитаны: %v\n", err)
+			} else {
+				fmt.Println("Правила выдачи перечитаны")
+			}
+			if err := messages.Reload(); err != nil {
+				fmt.Printf("Шаблоны писем не перечитаны: %v\n", err)
+			} else {
+				fmt.Println("Шаблоны писем перечитаны")
+			}
+		}
+	}()
+}
+
+// seedLibrary заполняет пустое хранилище начальными данными. Демо-учётные
+// записи с известными паролями - только с demoAccounts (dev.demo_accounts).
+func seedLibrary(library *services.Library, demoAccounts bool) {
+	author1ID, _ := library.AddAuthor("Лев Толстой", "tolstoy@mail.ru", "Русский писатель")
+	author2ID, _ := library.AddAuthor("Фёдор Достоевский", "dostoevsky@mail.ru", "Русский писатель")
+	author3ID, _ := library.AddAuthor("Антон Чехов", "chekhov@mail.ru", "Русский писатель и драматург")
+
+	library.AddBook("Война и мир", author1ID, 1869)
+	library.AddBook("Анна Каренина", author1ID, 1877)
+	library.AddBook("Преступление и наказание", author2ID, 1866)
+	library.AddBook("Братья Карамазовы", author2ID, 1880)
+	library.AddBook("Вишневый сад", author3ID, 1904)
+	library.AddBook("Чайка", author3ID, 1896)
 
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Ошибка запуска сервера: %v", err)
+	if !demoAccounts {
+		return
 	}
+	fmt.Println("⚠️  Созданы демо-учётные записи (dev.demo_accounts), не используйте в проде")
+	// Демо-учётные записи: reader@example.com / reader123,
+	// librarian@example.com / librarian123, admin@example.com / admin123
+	library.RegisterPatron(dto.CreatePatronRequest{
+		Name:     "Иван Петров",
+		Email:    "reader@example.com",
+		Password: "reader123",
+	})
+	library.CreateStaffAccount("librarian@example.com", "librarian123", models.RoleLibrarian)
+	library.CreateStaffAccount("admin@example.com", "admin123", models.RoleAdmin)
 }
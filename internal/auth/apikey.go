@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// APIKeyHeader - заголовок, в котором клиенты передают ключ.
+const APIKeyHeader = "X-API-Key"
+
+var ErrInvalidAPIKey = errors.New("неверный или отозванный API-ключ")
+
+// KeyVerifier проверяет API-ключ и возвращает права его клиента.
+type KeyVerifier interface {
+	VerifyAPIKey(key string) (Claims, error)
+}
+
+// NewAPIKey генерирует ключ вида lib_<префикс>_<секрет>. Префикс хранится
+// открыто и нужен, чтобы найти ключ и показать его в списке.
+func NewAPIKey() (key, prefix string) {
+	b := make([]byte, 28)
+	rand.Read(b)
+	prefix = hex.EncodeToString(b[:4])
+	return "lib_" + prefix + "_" + hex.EncodeToString(b[4:]), prefix
+}
+
+// APIKeyPrefix достаёт префикс из ключа.
+func APIKeyPrefix(key string) (string, bool) {
+	rest, ok := strings.CutPrefix(key, "lib_")
+	if !ok {
+		return "", false
+	}
+	prefix, _, ok := strings.Cut(rest, "_")
+	return prefix, ok && prefix != ""
+}
+
+// HashAPIKey - SHA-256 ключа. Ключи случайные и длинные, поэтому
+// медленный хеш вроде bcrypt для них не нужен.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+const claimsKey = "auth.claims"
+
+// Middleware проверяет токен из заголовка Authorization: Bearer <токен>
+// или API-ключ из заголовка X-API-Key, если они переданы. Запросы без
+// них проходят дальше анонимно, закрытые маршруты отсекает Required.
+func Middleware(signer *Signer, keys KeyVerifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if key := c.GetHeader(APIKeyHeader); key != "" {
+				claims, err := keys.VerifyAPIKey(key)
+				if err != nil {
+					c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+					return
+				}
+				c.Set(claimsKey, claims)
+			}
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			c.AbortWithStatusJSON(401, gin.H{"error": "ожидается заголовок Authorization: Bearer <токен>"})
+			return
+		}
+		claims, err := signer.Verify(strings.TrimSpace(token))
+		if err != nil {
+			c.AbortWithStatusJSON(401, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// Required пропускает только запросы с действующим токеном.
+func Required() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := Identity(c); !ok {
+			c.AbortWithStatusJSON(401, gin.H{"error": "требуется вход в систему"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Identity возвращает данные токена текущего запроса.
+func Identity(c *gin.Context) (Claims, bool) {
+	v, ok := c.Get(claimsKey)
+	if !ok {
+		return Claims{}, false
+	}
+	claims, ok := v.(Claims)
+	return claims, ok
+}
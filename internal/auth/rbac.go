@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"library-app/internal/models"
+)
+
+type Permission string
+
+const (
+	// Просмотр каталога открыт и без входа
+	PermCatalogRead  Permission = "catalog:read"
+	PermCatalogWrite Permission = "catalog:write"
+	// Свои брони, очередь, выдачи и штрафы
+	PermCirculationSelf Permission = "circulation:self"
+	// Выдача, возврат и действия от имени любого читателя
+	PermCirculationManage Permission = "circulation:manage"
+	PermPatronsManage     Permission = "patrons:manage"
+	PermFinesManage       Permission = "fines:manage"
+	PermStaffManage       Permission = "staff:manage"
+	PermConfigManage      Permission = "config:manage"
+	PermAPIKeysManage     Permission = "apikeys:manage"
+	// Шаблоны писем и уведомления
+	PermNotificationsManage Permission = "notifications:manage"
+	// Подписки внешних систем на события
+	PermWebhooksManage Permission = "webhooks:manage"
+)
+
+var allPermissions = []Permission{
+	PermCatalogRead, PermCatalogWrite, PermCirculationSelf, PermCirculationManage,
+	PermPatronsManage, PermFinesManage, PermStaffManage, PermConfigManage, PermAPIKeysManage,
+	PermNotificationsManage, PermWebhooksManage,
+}
+
+func ValidPermission(p string) bool {
+	for _, known := range allPermissions {
+		if string(known) == p {
+			return true
+		}
+	}
+	return false
+}
+
+var rolePermissions = map[string][]Permission{
+	models.RolePatron: {
+		PermCatalogRead, PermCirculationSelf,
+	},
+	models.RoleLibrarian: {
+		PermCatalogRead, PermCatalogWrite, PermCirculationSelf, PermCirculationManage,
+		PermPatronsManage, PermFinesManage, PermNotificationsManage,
+	},
+	models.RoleAdmin: {
+		PermCatalogRead, PermCatalogWrite, PermCirculationSelf, PermCirculationManage,
+		PermPatronsManage, PermFinesManage, PermStaffManage, PermConfigManage, PermAPIKeysManage,
+		PermNotificationsManage, PermWebhooksManage,
+	},
+}
+
+// Can проверяет право по матрице ролей. Пустая роль (учётные записи,
+// созданные до появления ролей) считается ролью читателя.
+func Can(role string, p Permission) bool {
+	if role == "" {
+		role = models.RolePatron
+	}
+	for _, granted := range rolePermissions[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Can для API-ключа разрешает только перечисленное в Scopes.
+func (c Claims) Can(p Permission) bool {
+	if c.Scopes != nil {
+		for _, scope := range c.Scopes {
+			if scope == string(p) {
+				return true
+			}
+		}
+		return false
+	}
+	return Can(c.Role, p)
+}
+
+// Require пропускает только вошедших пользователей с правом p.
+func Require(p Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := Identity(c)
+		if !ok {
+			c.AbortWithStatusJSON(401, gin.H{"error": "требуется вход в систему"})
+			return
+		}
+		if !claims.Can(p) {
+			Forbidden(c, "недостаточно прав: требуется "+string(p))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Forbidden - единый ответ 403 для всех запрещённых действий.
+func Forbidden(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(403, gin.H{
+		"error":  message,
+		"reason": "forbidden",
+	})
+}
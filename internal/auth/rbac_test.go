@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"library-app/internal/models"
+	"testing"
+)
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		perm                     Permission
+		patron, librarian, admin bool
+	}{
+		{PermCatalogRead, true, true, true},
+		{PermCatalogWrite, false, true, true},
+		{PermCirculationSelf, true, true, true},
+		{PermCirculationManage, false, true, true},
+		{PermPatronsManage, false, true, true},
+		{PermFinesManage, false, true, true},
+		{PermNotificationsManage, false, true, true},
+		{PermStaffManage, false, false, true},
+		{PermConfigManage, false, false, true},
+		{PermAPIKeysManage, false, false, true},
+		{PermWebhooksManage, false, false, true},
+	}
+	if len(tests) != len(allPermissions) {
+		t.Fatalf("в таблице %d прав, известно %d", len(tests), len(allPermissions))
+	}
+
+	for _, tt := range tests {
+		for role, want := range map[string]bool{
+			models.RolePatron:    tt.patron,
+			models.RoleLibrarian: tt.librarian,
+			models.RoleAdmin:     tt.admin,
+			// Учётные записи до появления ролей - читатели
+			"": tt.patron,
+		} {
+			if got := (Claims{Subject: "user@example.com", Role: role}).Can(tt.perm); got != want {
+				t.Errorf("роль %q, право %s: %v, ожидалось %v", role, tt.perm, got, want)
+			}
+		}
+		if Can("unknown", tt.perm) {
+			t.Errorf("неизвестной роли разрешено %s", tt.perm)
+		}
+	}
+}
+
+func TestScopesOverrideRole(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []string
+		allow  []Permission
+	}{
+		{"только каталог", []string{"catalog:read"}, []Permission{PermCatalogRead}},
+		{"выдача", []string{"catalog:read", "circulation:manage"}, []Permission{PermCatalogRead, PermCirculationManage}},
+		{"вебхуки", []string{"webhooks:manage"}, []Permission{PermWebhooksManage}},
+		{"пустой список", []string{}, nil},
+	}
+
+	for _, tt := range tests {
+		// Даже с ролью администратора права ключа - только из Scopes
+		claims := Claims{Subject: "apikey:abcd1234", Role: models.RoleAdmin, Scopes: tt.scopes}
+		for _, p := range allPermissions {
+			want := false
+			for _, allowed := range tt.allow {
+				want = want || allowed == p
+			}
+			if got := claims.Can(p); got != want {
+				t.Errorf("%s, право %s: %v, ожидалось %v", tt.name, p, got, want)
+			}
+		}
+	}
+}
+
+func TestValidPermission(t *testing.T) {
+	for _, p := range allPermissions {
+		if !ValidPermission(string(p)) {
+			t.Errorf("%s не признано правом", p)
+		}
+	}
+	for _, p := range []string{"", "admin", "catalog:*", "CATALOG:READ"} {
+		if ValidPermission(p) {
+			t.Errorf("%q признано правом", p)
+		}
+	}
+}
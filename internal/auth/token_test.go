@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIssueVerify(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	token, issued, err := s.Issue("reader@example.com", "patron")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := s.Verify(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "reader@example.com" || claims.Role != "patron" || claims.ExpiresAt != issued.ExpiresAt {
+		t.Fatalf("прочитано %+v, выдано %+v", claims, issued)
+	}
+	if claims.ExpiresAt-claims.IssuedAt != int64(time.Hour/time.Second) {
+		t.Fatalf("срок действия %d с", claims.ExpiresAt-claims.IssuedAt)
+	}
+
+	if _, err := NewSigner("other", time.Hour).Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("токен с чужим ключом: %v", err)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+	token, _, err := s.Issue("reader@example.com", "patron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, sig, _ := strings.Cut(token, ".")
+
+	// Роль подменена, подпись прежняя
+	payload, _ := base64.RawURLEncoding.DecodeString(body)
+	forged := strings.Replace(string(payload), `"role":"patron"`, `"role":"admin"`, 1)
+	if forged == string(payload) {
+		t.Fatalf("в токене нет роли: %s", payload)
+	}
+
+	sigBytes := []byte(sig)
+	sigBytes[0] ^= 1
+
+	for name, tampered := range map[string]string{
+		"тело":        base64.RawURLEncoding.EncodeToString([]byte(forged)) + "." + sig,
+		"подпись":     body + "." + string(sigBytes),
+		"без подписи": body,
+		"пустой":      "",
+	} {
+		if _, err := s.Verify(tampered); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: %v, ожидалось ErrInvalidToken", name, err)
+		}
+	}
+}
+
+func TestVerifyExpired(t *testing.T) {
+	s := NewSigner("secret", -time.Minute)
+	token, _, err := s.Issue("reader@example.com", "patron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Verify(token); !errors.Is(err, ErrTokenExpired) {
+		t.Fatalf("просроченный токен: %v", err)
+	}
+}
+
+func TestUnsubscribeToken(t *testing.T) {
+	s := NewSigner("secret", time.Hour)
+
+	token := s.UnsubscribeToken("reader@example.com", "loan_due")
+	email, event, err := s.VerifyUnsubscribe(token)
+	if err != nil || email != "reader@example.com" || event != "loan_due" {
+		t.Fatalf("отписка: %q %q %v", email, event, err)
+	}
+	if email, event, err := s.VerifyUnsubscribe(s.UnsubscribeToken("reader@example.com", "")); err != nil || email != "reader@example.com" || event != "" {
+		t.Fatalf("отписка от всех писем: %q %q %v", email, event, err)
+	}
+
+	// Ссылка из письма не годится для входа, токен входа - для отписки
+	if _, err := s.Verify(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("токен отписки принят как токен входа: %v", err)
+	}
+	session, _, err := s.Issue("reader@example.com", "patron")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.VerifyUnsubscribe(session); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("токен входа принят как токен отписки: %v", err)
+	}
+
+	// Адрес в ссылке не подменить
+	_, sig, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte("other@example.com|loan_due")) + "." + sig
+	if _, _, err := s.VerifyUnsubscribe(forged); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("подменённый адрес: %v", err)
+	}
+	if _, _, err := NewSigner("other", time.Hour).VerifyUnsubscribe(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("ссылка с чужим ключом: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"strings"
+)
+
+// Ссылки отписки в письмах подписываются тем же ключом, что и токены
+// входа, но с приставкой назначения, поэтому выдать одно за другое
+// нельзя. Срока действия у них нет: письмо могут открыть и через месяц.
+const unsubscribePurpose = "unsubscribe:"
+
+// UnsubscribeToken подписывает отписку email от писем о событии event
+// (пустой event - от всех писем).
+func (s *Signer) UnsubscribeToken(email, event string) string {
+	body := base64.RawURLEncoding.EncodeToString([]byte(email + "|" + event))
+	return body + "." + s.sign(unsubscribePurpose+body)
+}
+
+// VerifyUnsubscribe проверяет токен отписки и возвращает адрес и событие.
+func (s *Signer) VerifyUnsubscribe(token string) (email, event string, err error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(unsubscribePurpose+body))) {
+		return "", "", ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return "", "", ErrInvalidToken
+	}
+	email, event, ok = strings.Cut(string(payload), "|")
+	if !ok || email == "" {
+		return "", "", ErrInvalidToken
+	}
+	return email, event, nil
+}
@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock - источник текущего времени для сервисов.
+type Clock interface {
+	Now() time.Time
+}
+
+// Real - системное время.
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Simulated идёт вместе с системным временем, но его можно перевести
+// вперёд. Только для разработки и тестов: позволяет проверить истечение
+// броней и просрочку без ожидания.
+type Simulated struct {
+	mu     sync.RWMutex
+	offset time.Duration
+}
+
+func NewSimulated() *Simulated {
+	return &Simulated{}
+}
+
+func (s *Simulated) Now() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Now().Add(s.offset)
+}
+
+// Advance переводит часы вперёд на d и возвращает новое время.
+func (s *Simulated) Advance(d time.Duration) (time.Time, error) {
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("время можно переводить только вперёд")
+	}
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+	return s.Now(), nil
+}
+
+// Offset - насколько часы ушли вперёд от системного времени.
+func (s *Simulated) Offset() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.offset
+}
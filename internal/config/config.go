@@ -0,0 +1,378 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/goccy/go-yaml"
+	"library-app/internal/cors"
+	"library-app/internal/email"
+	"library-app/internal/ratelimit"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Server struct {
+	Addr string `yaml:"addr"`
+	// ShutdownTimeout - сколько ждать завершения запросов и очередей при остановке
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type Storage struct {
+	Kind            string        `yaml:"kind"`
+	Data            string        `yaml:"data"`
+	Journal         string        `yaml:"journal"`
+	CompactInterval time.Duration `yaml:"compact_interval"`
+	DSN             string        `yaml:"dsn"`
+}
+
+type Auth struct {
+	Secret   string        `yaml:"secret"`
+	TokenTTL time.Duration `yaml:"token_ttl"`
+	// Первый администратор, создаётся при запуске
+	AdminEmail    string `yaml:"admin_email"`
+	AdminPassword string `yaml:"admin_password"`
+}
+
+// Workers - пул обработчиков с очередью.
+type Workers struct {
+	Workers   int `yaml:"workers"`
+	QueueSize int `yaml:"queue_size"`
+}
+
+// Notifications - отправка писем и повторы при временных ошибках.
+type Notifications struct {
+	Workers        int           `yaml:"workers"`
+	QueueSize      int           `yaml:"queue_size"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay"`
+	RetryInterval  time.Duration `yaml:"retry_interval"`
+	ClaimTimeout   time.Duration `yaml:"claim_timeout"`
+}
+
+// Webhooks - доставка событий подписчикам.
+type Webhooks struct {
+	Timeout        time.Duration `yaml:"timeout"`
+	MaxAttempts    int           `yaml:"max_attempts"`
+	RetryBaseDelay time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay  time.Duration `yaml:"retry_max_delay"`
+	RetryInterval  time.Duration `yaml:"retry_interval"`
+}
+
+type Circulation struct {
+	Policy             string        `yaml:"policy"`
+	ExpirationInterval time.Duration `yaml:"expiration_interval"`
+}
+
+// Dev - режимы только для разработки и тестов.
+type Dev struct {
+	// TimeTravel включает симулированные часы и /dev/clock
+	TimeTravel bool `yaml:"time_travel"`
+	// DemoAccounts заводит в пустом хранилище демо-учётные записи
+	// с известными паролями
+	DemoAccounts bool `yaml:"demo_accounts"`
+}
+
+// Config - настройки приложения. Источники по возрастанию приоритета:
+// значения по умолчанию, файл YAML, переменные окружения, флаги.
+type Config struct {
+	Server        Server           `yaml:"server"`
+	Storage       Storage          `yaml:"storage"`
+	Auth          Auth             `yaml:"auth"`
+	Notifications Notifications    `yaml:"notifications"`
+	Reservations  Workers          `yaml:"reservations"`
+	Webhooks      Webhooks         `yaml:"webhooks"`
+	Circulation   Circulation      `yaml:"circulation"`
+	RateLimit     ratelimit.Config `yaml:"rate_limit"`
+	CORS          cors.Config      `yaml:"cors"`
+	Mail          email.Config     `yaml:"mail"`
+	Dev           Dev              `yaml:"dev"`
+}
+
+func Default() Config {
+	return Config{
+		Server: Server{Addr: ":8080", ShutdownTimeout: 15 * time.Second},
+		Storage: Storage{
+			Kind:            "json",
+			Data:            "library.json",
+			Journal:         "library.journal",
+			CompactInterval: 10 * time.Minute,
+			DSN:             "file:library.db?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_txlock=immediate",
+		},
+		Auth: Auth{TokenTTL: 24 * time.Hour},
+		Notifications: Notifications{
+			Workers:        3,
+			QueueSize:      100,
+			MaxAttempts:    5,
+			RetryBaseDelay: 30 * time.Second,
+			RetryMaxDelay:  time.Hour,
+			RetryInterval:  10 * time.Second,
+			ClaimTimeout:   10 * time.Minute,
+		},
+		Reservations: Workers{Workers: 3, QueueSize: 100},
+		Webhooks: Webhooks{
+			Timeout:        10 * time.Second,
+			MaxAttempts:    8,
+			RetryBaseDelay: 30 * time.Second,
+			RetryMaxDelay:  6 * time.Hour,
+			RetryInterval:  10 * time.Second,
+		},
+		Circulation: Circulation{
+			Policy:             "policy.json",
+			ExpirationInterval: time.Minute,
+		},
+		RateLimit: ratelimit.Default(),
+		CORS:      cors.Default(),
+		Mail:      email.Default(),
+	}
+}
+
+// option - настройка, которую можно задать переменной окружения и флагом.
+type option struct {
+	flag, env, usage string
+	value            func(c *Config) any
+}
+
+var options = []option{
+	{"addr", "LIBRARY_ADDR", "адрес HTTP-сервера", func(c *Config) any { return &c.Server.Addr }},
+	{"shutdown-timeout", "LIBRARY_SHUTDOWN_TIMEOUT", "срок корректной остановки сервера", func(c *Config) any { return &c.Server.ShutdownTimeout }},
+	{"storage", "LIBRARY_STORAGE", "хранилище: json, journal, sqlite или memory", func(c *Config) any { return &c.Storage.Kind }},
+	{"data", "LIBRARY_DATA", "путь к файлу данных (снимку)", func(c *Config) any { return &c.Storage.Data }},
+	{"journal", "LIBRARY_JOURNAL", "путь к журналу для journal-хранилища", func(c *Config) any { return &c.Storage.Journal }},
+	{"compact-interval", "LIBRARY_COMPACT_INTERVAL", "период сжатия журнала", func(c *Config) any { return &c.Storage.CompactInterval }},
+	{"dsn", "LIBRARY_DSN", "строка подключения для sqlite-хранилища", func(c *Config) any { return &c.Storage.DSN }},
+	{"auth-secret", "LIBRARY_AUTH_SECRET", "ключ подписи токенов", func(c *Config) any { return &c.Auth.Secret }},
+	{"token-ttl", "LIBRARY_TOKEN_TTL", "срок действия токена", func(c *Config) any { return &c.Auth.TokenTTL }},
+	{"admin-email", "LIBRARY_ADMIN_EMAIL", "email первого администратора", func(c *Config) any { return &c.Auth.AdminEmail }},
+	{"admin-password", "LIBRARY_ADMIN_PASSWORD", "пароль первого администратора", func(c *Config) any { return &c.Auth.AdminPassword }},
+	{"email-workers", "LIBRARY_EMAIL_WORKERS", "число почтовых обработчиков", func(c *Config) any { return &c.Notifications.Workers }},
+	{"email-queue", "LIBRARY_EMAIL_QUEUE", "размер очереди писем", func(c *Config) any { return &c.Notifications.QueueSize }},
+	{"email-max-attempts", "LIBRARY_EMAIL_MAX_ATTEMPTS", "попыток отправки письма до списка недоставленных", func(c *Config) any { return &c.Notifications.MaxAttempts }},
+	{"email-retry-base-delay", "LIBRARY_EMAIL_RETRY_BASE_DELAY", "задержка перед первым повтором письма", func(c *Config) any { return &c.Notifications.RetryBaseDelay }},
+	{"email-retry-max-delay", "LIBRARY_EMAIL_RETRY_MAX_DELAY", "наибольшая задержка между повторами", func(c *Config) any { return &c.Notifications.RetryMaxDelay }},
+	{"email-retry-interval", "LIBRARY_EMAIL_RETRY_INTERVAL", "период проверки исходящих писем", func(c *Config) any { return &c.Notifications.RetryInterval }},
+	{"email-claim-timeout", "LIBRARY_EMAIL_CLAIM_TIMEOUT", "через сколько письмо из очереди упавшей реплики отправляется заново", func(c *Config) any { return &c.Notifications.ClaimTimeout }},
+	{"webhook-timeout", "LIBRARY_WEBHOOK_TIMEOUT", "таймаут запроса к подписчику вебхука", func(c *Config) any { return &c.Webhooks.Timeout }},
+	{"webhook-max-attempts", "LIBRARY_WEBHOOK_MAX_ATTEMPTS", "попыток доставки вебхука", func(c *Config) any { return &c.Webhooks.MaxAttempts }},
+	{"webhook-retry-base-delay", "LIBRARY_WEBHOOK_RETRY_BASE_DELAY", "задержка перед первым повтором вебхука", func(c *Config) any { return &c.Webhooks.RetryBaseDelay }},
+	{"webhook-retry-max-delay", "LIBRARY_WEBHOOK_RETRY_MAX_DELAY", "наибольшая задержка между повторами вебхука", func(c *Config) any { return &c.Webhooks.RetryMaxDelay }},
+	{"webhook-retry-interval", "LIBRARY_WEBHOOK_RETRY_INTERVAL", "период проверки доставок вебхуков", func(c *Config) any { return &c.Webhooks.RetryInterval }},
+	{"reservation-workers", "LIBRARY_RESERVATION_WORKERS", "число обработчиков броней", func(c *Config) any { return &c.Reservations.Workers }},
+	{"reservation-queue", "LIBRARY_RESERVATION_QUEUE", "размер очереди броней", func(c *Config) any { return &c.Reservations.QueueSize }},
+	{"policy", "LIBRARY_POLICY", "файл правил выдачи (перечитывается по SIGHUP)", func(c *Config) any { return &c.Circulation.Policy }},
+	{"expiration-interval", "LIBRARY_EXPIRATION_INTERVAL", "период проверки просроченных броней", func(c *Config) any { return &c.Circulation.ExpirationInterval }},
+	{"rate-limit", "LIBRARY_RATE_LIMIT", "включить лимиты запросов", func(c *Config) any { return &c.RateLimit.Enabled }},
+	{"mail", "LIBRARY_MAIL", "доставка писем: smtp, file или fake", func(c *Config) any { return &c.Mail.Kind }},
+	{"mail-from", "LIBRARY_MAIL_FROM", "адрес отправителя писем", func(c *Config) any { return &c.Mail.From }},
+	{"mail-dir", "LIBRARY_MAIL_DIR", "папка для писем при доставке file", func(c *Config) any { return &c.Mail.Dir }},
+	{"mail-templates", "LIBRARY_MAIL_TEMPLATES", "папка с шаблонами писем", func(c *Config) any { return &c.Mail.Templates }},
+	{"mail-base-url", "LIBRARY_MAIL_BASE_URL", "адрес сервера для ссылок в письмах", func(c *Config) any { return &c.Mail.BaseURL }},
+	{"smtp-host", "LIBRARY_SMTP_HOST", "SMTP-сервер", func(c *Config) any { return &c.Mail.SMTP.Host }},
+	{"smtp-port", "LIBRARY_SMTP_PORT", "порт SMTP-сервера", func(c *Config) any { return &c.Mail.SMTP.Port }},
+	{"smtp-username", "LIBRARY_SMTP_USERNAME", "логин SMTP", func(c *Config) any { return &c.Mail.SMTP.Username }},
+	{"smtp-password", "LIBRARY_SMTP_PASSWORD", "пароль SMTP", func(c *Config) any { return &c.Mail.SMTP.Password }},
+	{"smtp-tls", "LIBRARY_SMTP_TLS", "шифрование SMTP: none, starttls или tls", func(c *Config) any { return &c.Mail.SMTP.TLS }},
+	{"dev-time-travel", "LIBRARY_DEV_TIME_TRAVEL", "симулированные часы и /dev/clock (только для тестов)", func(c *Config) any { return &c.Dev.TimeTravel }},
+	{"dev-demo-accounts", "LIBRARY_DEV_DEMO_ACCOUNTS", "демо-учётные записи с известными паролями (только для разработки)", func(c *Config) any { return &c.Dev.DemoAccounts }},
+	{"cors-origins", "LIBRARY_CORS_ORIGINS", "разрешённые источники CORS через запятую", func(c *Config) any { return &c.CORS.AllowedOrigins }},
+}
+
+func set(target any, s string) error {
+	switch v := target.(type) {
+	case *string:
+		*v = s
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("ожидается целое число")
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("ожидается true или false")
+		}
+		*v = b
+	case *time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("ожидается длительность, например 30s или 5m")
+		}
+		*v = d
+	case *[]string:
+		*v = nil
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*v = append(*v, item)
+			}
+		}
+	default:
+		return fmt.Errorf("неподдерживаемый тип %T", target)
+	}
+	return nil
+}
+
+// Load собирает настройки из файла (-config или LIBRARY_CONFIG),
+// окружения и флагов args и проверяет их.
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("library", flag.ContinueOnError)
+	path := fs.String("config", envOr("LIBRARY_CONFIG", "config.yaml"), "файл настроек YAML")
+
+	type flagValue struct{ option, value string }
+	var flags []flagValue
+	for _, o := range options {
+		o := o
+		usage := fmt.Sprintf("%s (%s)", o.usage, o.env)
+		record := func(s string) error {
+			flags = append(flags, flagValue{o.flag, s})
+			return nil
+		}
+		// Логические флаги можно указывать без значения: -rate-limit
+		if _, ok := o.value(&Config{}).(*bool); ok {
+			fs.BoolFunc(o.flag, usage, record)
+		} else {
+			fs.Func(o.flag, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	c := Default()
+	if err := c.loadFile(*path); err != nil {
+		return Config{}, err
+	}
+
+	for _, o := range options {
+		if s, ok := os.LookupEnv(o.env); ok {
+			if err := set(o.value(&c), s); err != nil {
+				return Config{}, fmt.Errorf("переменная %s: %w", o.env, err)
+			}
+		}
+	}
+	for _, f := range flags {
+		for _, o := range options {
+			if o.flag == f.option {
+				if err := set(o.value(&c), f.value); err != nil {
+					return Config{}, fmt.Errorf("флаг -%s: %w", o.flag, err)
+				}
+			}
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// loadFile накладывает настройки из файла. Файла может не быть.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("не удалось прочитать настройки %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data), yaml.DisallowUnknownField())
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("неверный формат настроек %s:\n%s", path, yaml.FormatError(err, false, true))
+	}
+	return nil
+}
+
+// Validate проверяет все настройки сразу и перечисляет все ошибки.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr: адрес не задан")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: должен быть положительным")
+	switch c.Storage.Kind {
+	case "json", "journal", "sqlite", "memory":
+	default:
+		check(false, "storage.kind: неизвестный тип хранилища %q", c.Storage.Kind)
+	}
+	check(c.Storage.Kind != "sqlite" || c.Storage.DSN != "", "storage.dsn: не задан для sqlite")
+	check(c.Storage.CompactInterval > 0, "storage.compact_interval: должен быть положительным")
+	check(c.Auth.TokenTTL > 0, "auth.token_ttl: должен быть положительным")
+	check(c.Auth.AdminEmail == "" || c.Auth.AdminPassword != "", "auth.admin_password: не задан для %s", c.Auth.AdminEmail)
+	check(c.Notifications.Workers > 0, "notifications.workers: нужен хотя бы один обработчик")
+	check(c.Notifications.QueueSize > 0, "notifications.queue_size: должен быть положительным")
+	check(c.Notifications.MaxAttempts > 0, "notifications.max_attempts: нужна хотя бы одна попытка")
+	check(c.Notifications.RetryBaseDelay > 0, "notifications.retry_base_delay: должен быть положительным")
+	check(c.Notifications.RetryMaxDelay >= c.Notifications.RetryBaseDelay, "notifications.retry_max_delay: меньше retry_base_delay")
+	check(c.Notifications.RetryInterval > 0, "notifications.retry_interval: должен быть положительным")
+	check(c.Notifications.ClaimTimeout > 0, "notifications.claim_timeout: должен быть положительным")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout: должен быть положительным")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts: нужна хотя бы одна попытка")
+	check(c.Webhooks.RetryBaseDelay > 0, "webhooks.retry_base_delay: должен быть положительным")
+	check(c.Webhooks.RetryMaxDelay >= c.Webhooks.RetryBaseDelay, "webhooks.retry_max_delay: меньше retry_base_delay")
+	check(c.Webhooks.RetryInterval > 0, "webhooks.retry_interval: должен быть положительным")
+	check(c.Reservations.Workers > 0, "reservations.workers: нужен хотя бы один обработчик")
+	check(c.Reservations.QueueSize > 0, "reservations.queue_size: должен быть положительным")
+	check(c.Circulation.ExpirationInterval > 0, "circulation.expiration_interval: должен быть положительным")
+	if err := c.RateLimit.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("rate_limit: %w", err))
+	}
+	if err := c.CORS.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("cors: %w", err))
+	}
+	if err := c.Mail.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("mail: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("неверные настройки:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+const redacted = "***"
+
+// Redacted - копия настроек без секретов, для вывода.
+func (c Config) Redacted() Config {
+	if c.Auth.Secret != "" {
+		c.Auth.Secret = redacted
+	}
+	if c.Auth.AdminPassword != "" {
+		c.Auth.AdminPassword = redacted
+	}
+	if c.Mail.SMTP.Password != "" {
+		c.Mail.SMTP.Password = redacted
+	}
+	if i := strings.Index(c.Storage.DSN, "@"); i >= 0 {
+		c.Storage.DSN = redacted + c.Storage.DSN[i:]
+	}
+	return c
+}
+
+// Map - настройки в виде, пригодном для ответа API: длительности
+// записаны строками ("1m0s"), а не наносекундами.
+func (c Config) Map() (map[string]any, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,176 @@
+package cors
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Config - настройки CORS. Origin задаётся точно или шаблоном
+// ("https://*.example.com"), "*" разрешает любой источник.
+type Config struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	MaxAge           int      `json:"max_age"`
+}
+
+func Default() Config {
+	return Config{
+		AllowedOrigins: []string{"*"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
+		ExposedHeaders: []string{"X-RateLimit-Limit", "X-RateLimit-Remaining", "Retry-After"},
+		MaxAge:         600,
+	}
+}
+
+func (c Config) Validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			if c.AllowCredentials {
+				// Браузер не примет "*" вместе с cookie, а отражать любой origin небезопасно
+				return fmt.Errorf("allow_credentials нельзя сочетать с origin \"*\"")
+			}
+			continue
+		}
+		scheme, host, ok := strings.Cut(origin, "://")
+		if _, err := path.Match(host, ""); !ok || scheme == "" || host == "" || err != nil {
+			return fmt.Errorf("неверный шаблон origin %q, ожидается scheme://host", origin)
+		}
+	}
+	if c.MaxAge < 0 {
+		return fmt.Errorf("max_age не может быть отрицательным")
+	}
+	return nil
+}
+
+func (c Config) allowOrigin(origin string) bool {
+	if contains(c.AllowedOrigins, "*") {
+		return true
+	}
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, pattern := range c.AllowedOrigins {
+		// Шаблон сравнивается со схемой и хостом (с портом) отдельно:
+		// "*" в хосте не должен захватывать "://"
+		scheme, host, _ := strings.Cut(strings.ToLower(pattern), "://")
+		if scheme != u.Scheme {
+			continue
+		}
+		if ok, _ := path.Match(host, u.Host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware отвечает на preflight-запросы методами, которые есть у
+// запрошенного маршрута, и добавляет заголовки CORS к обычным ответам.
+// Подключать первым, чтобы заголовки были и у ответов 401/429.
+func Middleware(c Config, router *gin.Engine) gin.HandlerFunc {
+	var (
+		once   sync.Once
+		routes gin.RoutesInfo
+	)
+	allowHeaders := strings.Join(c.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(c.ExposedHeaders, ", ")
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		preflight := ctx.Request.Method == http.MethodOptions &&
+			ctx.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin == "" {
+			ctx.Next()
+			return
+		}
+		ctx.Writer.Header().Add("Vary", "Origin")
+		if !c.allowOrigin(origin) {
+			if preflight {
+				ctx.AbortWithStatusJSON(403, gin.H{"error": "источник не разрешён: " + origin, "reason": "cors"})
+				return
+			}
+			ctx.Next()
+			return
+		}
+
+		if c.AllowCredentials || !contains(c.AllowedOrigins, "*") {
+			ctx.Header("Access-Control-Allow-Origin", origin)
+		} else {
+			ctx.Header("Access-Control-Allow-Origin", "*")
+		}
+		if c.AllowCredentials {
+			ctx.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				ctx.Header("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			ctx.Next()
+			return
+		}
+
+		// Маршруты регистрируются после подключения middleware
+		once.Do(func() { routes = router.Routes() })
+		methods := routeMethods(routes, ctx.Request.URL.Path)
+		if len(methods) == 0 {
+			ctx.AbortWithStatusJSON(404, gin.H{"error": "маршрут не найден"})
+			return
+		}
+
+		ctx.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if allowHeaders != "" {
+			ctx.Header("Access-Control-Allow-Headers", allowHeaders)
+		}
+		if c.MaxAge > 0 {
+			ctx.Header("Access-Control-Max-Age", strconv.Itoa(c.MaxAge))
+		}
+		ctx.AbortWithStatus(204)
+	}
+}
+
+// routeMethods - методы маршрутов, под которые подходит путь.
+func routeMethods(routes gin.RoutesInfo, requestPath string) []string {
+	var methods []string
+	for _, route := range routes {
+		if matchRoute(route.Path, requestPath) && !contains(methods, route.Method) {
+			methods = append(methods, route.Method)
+		}
+	}
+	return methods
+}
+
+func matchRoute(pattern, requestPath string) bool {
+	want := strings.Split(strings.Trim(pattern, "/"), "/")
+	got := strings.Split(strings.Trim(requestPath, "/"), "/")
+	for i, part := range want {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(got) {
+			return false
+		}
+		if !strings.HasPrefix(part, ":") && part != got[i] {
+			return false
+		}
+	}
+	return len(want) == len(got)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
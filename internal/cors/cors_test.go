@@ -0,0 +1,131 @@
+package cors
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAllowOrigin(t *testing.T) {
+	c := Config{AllowedOrigins: []string{"https://app.example.com", "https://*.example.com", "http://localhost:*"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"https://admin.example.com", true},
+		{"https://a.b.example.com", true},
+		{"http://localhost:3000", true},
+		{"https://example.com", false},
+		{"http://admin.example.com", false},
+		{"https://localhost:3000", false},
+		{"https://evil.com", false},
+		{"https://example.com.evil.com", false},
+		{"https://admin.example.com.evil.com", false},
+		{"https://evil.com/.example.com", false},
+		{"null", false},
+		{"app.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := c.allowOrigin(tt.origin); got != tt.want {
+			t.Errorf("allowOrigin(%q) = %v, ожидалось %v", tt.origin, got, tt.want)
+		}
+	}
+
+	wildcard := Config{AllowedOrigins: []string{"*"}}
+	if !wildcard.allowOrigin("https://evil.com") {
+		t.Error("\"*\" не разрешает произвольный origin")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"по умолчанию", Default(), false},
+		{"шаблон поддомена", Config{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true}, false},
+		{"любой origin с cookie", Config{AllowedOrigins: []string{"*"}, AllowCredentials: true}, true},
+		{"без схемы", Config{AllowedOrigins: []string{"example.com"}}, true},
+		{"без хоста", Config{AllowedOrigins: []string{"https://"}}, true},
+		{"неверный шаблон", Config{AllowedOrigins: []string{"https://[example.com"}}, true},
+		{"отрицательный max_age", Config{MaxAge: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: ошибка %v, ожидалась ли: %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func newRouter(c Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware(c, router))
+	router.GET("/books/:id", func(ctx *gin.Context) { ctx.JSON(200, gin.H{}) })
+	router.PUT("/books/:id", func(ctx *gin.Context) { ctx.JSON(200, gin.H{}) })
+	return router
+}
+
+func serve(router *gin.Engine, method, origin string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/books/1", nil)
+	req.Header.Set("Origin", origin)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPreflight(t *testing.T) {
+	c := Default()
+	c.AllowedOrigins = []string{"https://*.example.com"}
+	c.AllowCredentials = true
+	router := newRouter(c)
+	preflight := map[string]string{"Access-Control-Request-Method": "PUT"}
+
+	w := serve(router, http.MethodOptions, "https://app.example.com", preflight)
+	if w.Code != 204 {
+		t.Fatalf("preflight: код %d", w.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization, X-API-Key",
+		"Access-Control-Max-Age":           "600",
+		"Vary":                             "Origin",
+	}
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s: %q, ожидалось %q", name, got, value)
+		}
+	}
+
+	if w := serve(router, http.MethodOptions, "https://example.com.evil.com", preflight); w.Code != 403 {
+		t.Fatalf("preflight чужого источника: код %d", w.Code)
+	}
+
+	// Обычный запрос чужого источника выполняется, но без заголовков CORS
+	w = serve(router, http.MethodGet, "https://evil.com", nil)
+	if w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("запрос чужого источника: код %d, Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	w = serve(router, http.MethodGet, "https://app.example.com", nil)
+	if got := w.Header().Get("Access-Control-Expose-Headers"); got != "X-RateLimit-Limit, X-RateLimit-Remaining, Retry-After" {
+		t.Fatalf("Expose-Headers: %q", got)
+	}
+}
+
+func TestPreflightAnyOrigin(t *testing.T) {
+	router := newRouter(Default())
+	w := serve(router, http.MethodOptions, "https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	if w.Code != 204 || w.Header().Get("Access-Control-Allow-Origin") != "*" ||
+		w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("preflight с \"*\": код %d, заголовки %v", w.Code, w.Header())
+	}
+}
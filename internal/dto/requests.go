@@ -1,5 +1,7 @@
 package dto
 
+import "library-app/internal/models"
+
 type CreateBookRequest struct {
 	Title    string `json:"title" binding:"required"`
 	AuthorID int    `json:"author_id" binding:"required"`
@@ -24,6 +26,122 @@ type CreateAuthorRequest struct {
 }
 
 type ReserveBookRequest struct {
+	UserEmail string `json:"user_email"`
+	Days      int    `json:"days"`
+	CopyID    int    `json:"copy_id"`
+}
+
+type CheckoutBookRequest struct {
+	UserEmail string `json:"user_email" binding:"required"`
+	Days      int    `json:"days"`
+	CopyID    int    `json:"copy_id"`
+}
+
+type ReturnBookRequest struct {
 	UserEmail string `json:"user_email" binding:"required"`
-	Days      int    `json:"days" binding:"required"`
+	CopyID    int    `json:"copy_id"`
+}
+
+type RenewRequest struct {
+	Days int `json:"days"`
+}
+
+type WaitlistRequest struct {
+	UserEmail string `json:"user_email"`
+}
+
+type CreateCopyRequest struct {
+	Barcode  string `json:"barcode"`
+	Branch   string `json:"branch"`
+	Location string `json:"location"`
+	ItemType string `json:"item_type"`
+}
+
+// Суммы указываются в копейках; 0 - весь остаток штрафа.
+type PayFineRequest struct {
+	Amount models.Money `json:"amount"`
+}
+
+type WaiveFineRequest struct {
+	Amount models.Money `json:"amount"`
+	Reason string       `json:"reason"`
+}
+
+type CreatePatronRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Phone    string `json:"phone"`
+	Address  string `json:"address"`
+	Language string `json:"language" binding:"omitempty,oneof=ru en"`
+}
+
+type UpdatePatronRequest struct {
+	Name     *string `json:"name"`
+	Phone    *string `json:"phone"`
+	Address  *string `json:"address"`
+	Status   *string `json:"status"`
+	Category *string `json:"category"`
+	Language *string `json:"language" binding:"omitempty,oneof=ru en"`
+	// Renew продлевает билет на год
+	Renew bool `json:"renew"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type CreateStaffRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+type SetRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+}
+
+// AdvanceClockRequest - на сколько перевести часы: duration ("36h")
+// и/или days.
+type AdvanceClockRequest struct {
+	Duration string `json:"duration"`
+	Days     int    `json:"days"`
+}
+
+// UpdateNotificationPreferencesRequest - изменение настроек писем.
+// Events включает и отключает отдельные события, остальные поля
+// меняются, только если заданы. Пустые QuietStart и QuietEnd снимают
+// тихие часы.
+type UpdateNotificationPreferencesRequest struct {
+	Events     map[string]bool `json:"events"`
+	Channel    *string         `json:"channel" binding:"omitempty,oneof=email none"`
+	Language   *string         `json:"language" binding:"omitempty,oneof=ru en"`
+	QuietStart *string         `json:"quiet_start"`
+	QuietEnd   *string         `json:"quiet_end"`
+}
+
+// CreateWebhookRequest - подписка на события. Без secret он создаётся
+// случайным и возвращается один раз. Пустой events - все события.
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+}
+
+type UpdateWebhookRequest struct {
+	URL    *string   `json:"url" binding:"omitempty,url"`
+	Secret *string   `json:"secret"`
+	Events *[]string `json:"events"`
+	Active *bool     `json:"active"`
 }
@@ -1,12 +1,19 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type BookResponse struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	AuthorID    int    `json:"author_id"`
-	AuthorName  string `json:"author_name"`
-	Year        int    `json:"year"`
-	IsAvailable bool   `json:"is_available"`
+	ID              int    `json:"id"`
+	Title           string `json:"title"`
+	AuthorID        int    `json:"author_id"`
+	AuthorName      string `json:"author_name"`
+	Year            int    `json:"year"`
+	IsAvailable     bool   `json:"is_available"`
+	TotalCopies     int    `json:"total_copies"`
+	AvailableCopies int    `json:"available_copies"`
 }
 
 type AuthorResponse struct {
@@ -15,3 +22,61 @@ type AuthorResponse struct {
 	Email     string `json:"email"`
 	Biography string `json:"biography"`
 }
+
+// AccountResponse - учётная запись без хеша пароля.
+type AccountResponse struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIKeyResponse - API-ключ без хеша. Сам ключ возвращается только при создании.
+type APIKeyResponse struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Active     bool       `json:"active"`
+}
+
+// NotificationPreferencesResponse - настройки писем читателя: для каждого
+// события, приходит ли письмо о нём.
+type NotificationPreferencesResponse struct {
+	Events     map[string]bool `json:"events"`
+	Channel    string          `json:"channel"`
+	Language   string          `json:"language"`
+	QuietStart string          `json:"quiet_start,omitempty"`
+	QuietEnd   string          `json:"quiet_end,omitempty"`
+}
+
+// WebhookResponse - подписка без секрета. Secret заполнен только
+// в ответе на создание.
+type WebhookResponse struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Secret    string    `json:"secret,omitempty"`
+}
+
+// WebhookDeliveryResponse - запись журнала доставок с телом запроса.
+type WebhookDeliveryResponse struct {
+	ID            int             `json:"id"`
+	WebhookID     int             `json:"webhook_id"`
+	Event         string          `json:"event"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  int             `json:"response_code,omitempty"`
+	LastError     string          `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Payload       json.RawMessage `json:"payload"`
+}
@@ -0,0 +1,36 @@
+package email
+
+import (
+	"errors"
+	"net/textproto"
+)
+
+// PermanentError - сбой, который повтор не исправит: неверный адрес,
+// отказ сервера с кодом 5xx. Остальные ошибки считаются временными.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// smtpError помечает ответы сервера 5xx как постоянные ошибки.
+func smtpError(err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return Permanent(err)
+	}
+	return err
+}
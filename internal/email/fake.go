@@ -0,0 +1,36 @@
+package email
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake запоминает письма вместо отправки. Если задан Err, Send
+// возвращает его - так проверяются сбои доставки.
+type Fake struct {
+	mu   sync.Mutex
+	sent []Message
+	Err  error
+}
+
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+func (f *Fake) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// Sent - отправленные письма в порядке отправки.
+func (f *Fake) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
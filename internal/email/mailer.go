@@ -0,0 +1,114 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+)
+
+// Message - письмо одному получателю. HTML необязателен: без него
+// отправляется только текстовая часть.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer доставляет письма.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+const (
+	KindSMTP = "smtp"
+	KindFile = "file"
+	KindFake = "fake"
+
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+)
+
+type SMTPConfig struct {
+	Host     string        `yaml:"host"`
+	Port     int           `yaml:"port"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	TLS      string        `yaml:"tls"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// Config - способ доставки писем: smtp, file (папка в формате maildir
+// для разработки) или fake (письма только запоминаются, для тестов).
+type Config struct {
+	Kind string     `yaml:"kind"`
+	From string     `yaml:"from"`
+	Dir  string     `yaml:"dir"`
+	SMTP SMTPConfig `yaml:"smtp"`
+	// Templates - папка с шаблонами писем, заменяющими встроенные
+	Templates string `yaml:"templates"`
+	// BaseURL - адрес сервера для ссылок в письмах (отписка)
+	BaseURL string `yaml:"base_url"`
+}
+
+func Default() Config {
+	return Config{
+		Kind:      KindFile,
+		From:      "Библиотека <library@localhost>",
+		Dir:       "mail",
+		Templates: "templates",
+		BaseURL:   "http://localhost:8080",
+		SMTP:      SMTPConfig{Port: 587, TLS: TLSStartTLS, Timeout: 30 * time.Second},
+	}
+}
+
+func (c Config) Validate() error {
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		return fmt.Errorf("неверный адрес отправителя %q", c.From)
+	}
+	if u, err := url.Parse(c.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("base_url: ожидается адрес вида http://host:port, получено %q", c.BaseURL)
+	}
+	switch c.Kind {
+	case KindFile:
+		if c.Dir == "" {
+			return fmt.Errorf("не задана папка для писем")
+		}
+	case KindSMTP:
+		if c.SMTP.Host == "" || c.SMTP.Port <= 0 {
+			return fmt.Errorf("не задан SMTP-сервер")
+		}
+		switch c.SMTP.TLS {
+		case TLSNone, TLSStartTLS, TLSImplicit:
+		default:
+			return fmt.Errorf("smtp.tls: ожидается none, starttls или tls, получено %q", c.SMTP.TLS)
+		}
+		if c.SMTP.Timeout <= 0 {
+			return fmt.Errorf("smtp.timeout: должен быть положительным")
+		}
+	case KindFake:
+	default:
+		return fmt.Errorf("неизвестный способ доставки %q", c.Kind)
+	}
+	return nil
+}
+
+// New создаёт Mailer по настройкам.
+func New(c Config) (Mailer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	from, _ := mail.ParseAddress(c.From)
+
+	switch c.Kind {
+	case KindSMTP:
+		return NewSMTP(c.SMTP, from), nil
+	case KindFile:
+		return NewFileOutbox(c.Dir, from)
+	default:
+		return NewFake(), nil
+	}
+}
@@ -0,0 +1,112 @@
+package email
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readMessage(t *testing.T, msg Message) *mail.Message {
+	t.Helper()
+	raw, err := build(&mail.Address{Name: "Библиотека", Address: "library@localhost"}, msg, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func decodeBase64(t *testing.T, r io.Reader) string {
+	t.Helper()
+	data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBuildEncodesCyrillicSubject(t *testing.T) {
+	subject := "Книга «Чайка» ждёт вас в читальном зале до конца недели"
+	msg := readMessage(t, Message{To: "reader@example.com", Subject: subject, Text: "Здравствуйте!"})
+
+	// RFC 2047: в заголовке только ASCII, кодированные слова не длиннее 75 символов
+	raw := msg.Header.Get("Subject")
+	if !strings.HasPrefix(raw, "=?utf-8?b?") {
+		t.Fatalf("тема не закодирована: %q", raw)
+	}
+	for _, word := range strings.Fields(raw) {
+		if len(word) > 75 {
+			t.Fatalf("кодированное слово длиннее 75 символов: %q", word)
+		}
+	}
+	for _, r := range raw {
+		if r > 127 {
+			t.Fatalf("в заголовке не-ASCII символы: %q", raw)
+		}
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != subject {
+		t.Fatalf("тема %q, ожидалось %q", decoded, subject)
+	}
+
+	from, err := msg.Header.AddressList("From")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from[0].Name != "Библиотека" {
+		t.Fatalf("отправитель %q", from[0].Name)
+	}
+
+	if body := decodeBase64(t, msg.Body); body != "Здравствуйте!" {
+		t.Fatalf("текст письма %q", body)
+	}
+}
+
+func TestBuildAlternativeParts(t *testing.T) {
+	msg := readMessage(t, Message{
+		To:      "reader@example.com",
+		Subject: "Напоминание",
+		Text:    "Срок возврата - завтра",
+		HTML:    "<p>Срок возврата - <b>завтра</b></p>",
+	})
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("тип письма %s", mediaType)
+	}
+
+	want := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Срок возврата - завтра"},
+		{"text/html; charset=utf-8", "<p>Срок возврата - <b>завтра</b></p>"},
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	for _, w := range want {
+		part, err := parts.NextRawPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := part.Header.Get("Content-Type"); got != w.contentType {
+			t.Fatalf("тип части %s, ожидалось %s", got, w.contentType)
+		}
+		if body := decodeBase64(t, part); body != w.body {
+			t.Fatalf("часть %s: %q", w.contentType, body)
+		}
+	}
+	if _, err := parts.NextRawPart(); err != io.EOF {
+		t.Fatalf("лишняя часть письма: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileOutbox складывает письма в папку в формате maildir (tmp/, new/,
+// cur/): их можно открыть почтовым клиентом или просто прочитать.
+type FileOutbox struct {
+	dir     string
+	from    *mail.Address
+	counter atomic.Uint64
+}
+
+func NewFileOutbox(dir string, from *mail.Address) (*FileOutbox, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("не удалось создать папку для писем: %w", err)
+		}
+	}
+	return &FileOutbox{dir: dir, from: from}, nil
+}
+
+func (o *FileOutbox) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := build(o.from, msg, now)
+	if err != nil {
+		return Permanent(err)
+	}
+
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%d_%d.%s.eml", now.Unix(), os.Getpid(), o.counter.Add(1), host)
+
+	// Как в maildir: пишем в tmp/ и переносим в new/ целиком
+	tmp := filepath.Join(o.dir, "tmp", name)
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(o.dir, "new", name))
+}
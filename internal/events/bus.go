@@ -0,0 +1,142 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"library-app/internal/storage"
+	"slices"
+	"sync"
+)
+
+// Handler - синхронный подписчик. Вызывается внутри транзакции, в которой
+// произошло событие, и пишет через неё же: ошибка подписчика отменяет
+// всю операцию. Так письма и вебхуки попадают в исходящие вместе
+// с изменением, которое их вызвало.
+type Handler func(tx storage.Tx, e Event) error
+
+// Listener - асинхронный подписчик. Получает событие после фиксации
+// транзакции в отдельной горутине и ничего не может отменить.
+type Listener func(e Event)
+
+// all - ключ подписчиков на все события
+const all = ""
+
+// Bus - шина доменных событий внутри процесса.
+type Bus struct {
+	mu        sync.RWMutex
+	handlers  map[string][]Handler
+	listeners map[string][]Listener
+	counts    map[string]uint64
+	wg        sync.WaitGroup
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		handlers:  map[string][]Handler{},
+		listeners: map[string][]Listener{},
+		counts:    map[string]uint64{},
+	}
+}
+
+// Subscribe подписывает h на события типа E.
+func Subscribe[E Event](b *Bus, h func(tx storage.Tx, e E) error) {
+	var zero E
+	b.subscribe(zero.EventName(), func(tx storage.Tx, e Event) error {
+		return h(tx, e.(E))
+	})
+}
+
+// SubscribeAsync подписывает l на события типа E после фиксации.
+func SubscribeAsync[E Event](b *Bus, l func(e E)) {
+	var zero E
+	b.subscribeAsync(zero.EventName(), func(e Event) {
+		l(e.(E))
+	})
+}
+
+// SubscribeAll и SubscribeAllAsync - подписка на все события.
+func (b *Bus) SubscribeAll(h Handler) {
+	b.subscribe(all, h)
+}
+
+func (b *Bus) SubscribeAllAsync(l Listener) {
+	b.subscribeAsync(all, l)
+}
+
+func (b *Bus) subscribe(name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], h)
+}
+
+func (b *Bus) subscribeAsync(name string, l Listener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners[name] = append(b.listeners[name], l)
+}
+
+// Publish передаёт событие синхронным подписчикам в порядке подписки
+// и останавливается на первой ошибке.
+func (b *Bus) Publish(tx storage.Tx, e Event) error {
+	b.mu.RLock()
+	handlers := slices.Concat(b.handlers[e.EventName()], b.handlers[all])
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		if err := h(tx, e); err != nil {
+			return fmt.Errorf("подписчик события %s: %w", e.EventName(), err)
+		}
+	}
+	return nil
+}
+
+// Dispatch передаёт асинхронным подписчикам события зафиксированной
+// транзакции. Паника подписчика записывается в лог и не роняет сервер.
+func (b *Bus) Dispatch(published []Event) {
+	for _, e := range published {
+		b.mu.Lock()
+		b.counts[e.EventName()]++
+		listeners := slices.Concat(b.listeners[e.EventName()], b.listeners[all])
+		b.mu.Unlock()
+
+		for _, l := range listeners {
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				defer func() {
+					if r := recover(); r != nil {
+						fmt.Printf("Подписчик события %s упал: %v\n", e.EventName(), r)
+					}
+				}()
+				l(e)
+			}()
+		}
+	}
+}
+
+// Stats - сколько событий каждого типа зафиксировано с запуска.
+func (b *Bus) Stats() map[string]uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make(map[string]uint64, len(b.counts))
+	for name, n := range b.counts {
+		stats[name] = n
+	}
+	return stats
+}
+
+// Wait дожидается асинхронных подписчиков, но не дольше, чем позволяет ctx.
+func (b *Bus) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
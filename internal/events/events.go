@@ -0,0 +1,41 @@
+package events
+
+import "library-app/internal/models"
+
+// Event - доменное событие библиотеки. Имя события - имя его типа.
+type Event interface {
+	EventName() string
+}
+
+type BookAdded struct{ Book *models.Book }
+type BookUpdated struct{ Book *models.Book }
+type BookDeleted struct{ Book *models.Book }
+type AuthorAdded struct{ Author *models.Author }
+
+// ReservationCreated - новая бронь. FromWaitlist - бронь создана для
+// первого в очереди ожидания, когда освободился экземпляр.
+type ReservationCreated struct {
+	Reservation  *models.Reservation
+	FromWaitlist bool
+}
+
+type ReservationCancelled struct{ Reservation *models.Reservation }
+type ReservationExpired struct{ Reservation *models.Reservation }
+
+type BookCheckedOut struct{ Loan *models.Loan }
+type BookReturned struct{ Loan *models.Loan }
+
+// LoanDueSoon - срок возврата скоро наступит. Публикуется один раз
+// на выдачу и ещё раз после продления.
+type LoanDueSoon struct{ Loan *models.Loan }
+
+func (BookAdded) EventName() string            { return "BookAdded" }
+func (BookUpdated) EventName() string          { return "BookUpdated" }
+func (BookDeleted) EventName() string          { return "BookDeleted" }
+func (AuthorAdded) EventName() string          { return "AuthorAdded" }
+func (ReservationCreated) EventName() string   { return "ReservationCreated" }
+func (ReservationCancelled) EventName() string { return "ReservationCancelled" }
+func (ReservationExpired) EventName() string   { return "ReservationExpired" }
+func (BookCheckedOut) EventName() string       { return "BookCheckedOut" }
+func (BookReturned) EventName() string         { return "BookReturned" }
+func (LoanDueSoon) EventName() string          { return "LoanDueSoon" }
@@ -1,28 +1,103 @@
 package handlers
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
+	"html/template"
+	"library-app/internal/auth"
+	"library-app/internal/clock"
+	"library-app/internal/config"
+	"library-app/internal/cors"
 	"library-app/internal/dto"
 	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/ratelimit"
 	"library-app/internal/services"
+	"library-app/internal/templates"
 	"strconv"
+	"strings"
+	"time"
 )
 
-func SetupRouter(library *services.Library) *gin.Engine {
+func SetupRouter(library *services.Library, signer *auth.Signer, cfg config.Config) *gin.Engine {
 	router := gin.Default()
+	// Не доверяем X-Forwarded-For: иначе клиент обойдёт лимиты, подставив чужой IP
+	router.SetTrustedProxies(nil)
 
-	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type")
+	router.Use(cors.Middleware(cfg.CORS, router))
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
-		c.Next()
-	})
+	// Неудачные попытки входа по токену или ключу считаются по IP до
+	// проверки, остальные запросы - по пользователю после неё
+	limiter := ratelimit.New(cfg.RateLimit)
+	router.Use(limiter.Failures(ratelimit.AuthFailures, clientIP, 401))
+	router.Use(auth.Middleware(signer, library))
+	router.Use(limiter.Middleware(rateGroup, rateClient))
+
+	// Auth endpoints
+	authGroup := router.Group("/auth")
+	{
+		authGroup.POST("/login", func(c *gin.Context) {
+			var req dto.LoginRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			account, err := library.Authenticate(req.Email, req.Password)
+			if err != nil {
+				c.JSON(401, gin.H{"error": err.Error()})
+				return
+			}
+
+			token, claims, err := signer.Issue(account.Email, account.Role)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"token":      token,
+				"expires_at": time.Unix(claims.ExpiresAt, 0),
+			})
+		})
+
+		authGroup.GET("/me", auth.Required(), func(c *gin.Context) {
+			claims, _ := auth.Identity(c)
+			account, err := library.FindAccount(claims.Subject)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+
+			resp := gin.H{"success": true, "data": account}
+			// У сотрудников может не быть читательского билета
+			if patron, err := library.FindPatron(claims.Subject); err == nil {
+				resp["patron"] = patron
+			}
+			c.JSON(200, resp)
+		})
+
+		authGroup.POST("/password", auth.Required(), func(c *gin.Context) {
+			var req dto.ChangePasswordRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			claims, _ := auth.Identity(c)
+			err := library.ChangePassword(claims.Subject, req.OldPassword, req.NewPassword)
+			if errors.Is(err, services.ErrBadCredentials) {
+				c.JSON(401, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"message": "Пароль изменён"})
+		})
+	}
 
 	// Books endpoints
 	books := router.Group("/books")
@@ -44,8 +119,8 @@ func SetupRouter(library *services.Library) *gin.Engine {
 				return
 			}
 
-			book := library.FindBook(id)
-			if book == nil {
+			book, err := library.GetBookDetails(id)
+			if err != nil {
 				c.JSON(404, gin.H{"error": "Книга не найдена"})
 				return
 			}
@@ -53,6 +128,53 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			c.JSON(200, gin.H{"data": book})
 		})
 
+		books.GET("/:id/copies", func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
+			}
+
+			copies, err := library.GetBookCopies(bookID)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    copies,
+				"count":   len(copies),
+			})
+		})
+
+		books.POST("/:id/copies", auth.Require(auth.PermCatalogWrite), func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
+			}
+
+			var req dto.CreateCopyRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			bookCopy, err := library.AddCopy(bookID, req.Barcode, req.Branch, req.Location, req.ItemType)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(201, gin.H{
+				"message": "Экземпляр успешно добавлен",
+				"data":    bookCopy,
+			})
+		})
+
 		// ИСПРАВЛЕННЫЙ ПОИСК - убрал :search из пути
 		books.GET("/search/advanced", func(c *gin.Context) {
 			var req dto.SearchBookRequest
@@ -78,7 +200,7 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			})
 		})
 
-		books.POST("/", func(c *gin.Context) {
+		books.POST("/", auth.Require(auth.PermCatalogWrite), func(c *gin.Context) {
 			var req dto.CreateBookRequest
 			if err := c.ShouldBindJSON(&req); err != nil {
 				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
@@ -94,7 +216,7 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			c.JSON(201, gin.H{"message": "Книга успешно добавлена"})
 		})
 
-		books.POST("/:id/reserve", func(c *gin.Context) {
+		books.POST("/:id/reserve", auth.Require(auth.PermCirculationSelf), func(c *gin.Context) {
 			idStr := c.Param("id")
 			bookID, err := strconv.Atoi(idStr)
 			if err != nil {
@@ -103,21 +225,126 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			}
 
 			var req dto.ReserveBookRequest
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+			userEmail, ok := actingEmail(c, req.UserEmail, auth.PermCirculationManage)
+			if !ok {
 				return
 			}
 
-			err = library.ReserveBook(bookID, req.UserEmail, req.Days)
+			err = library.ReserveBook(bookID, userEmail, req.Days, req.CopyID)
+			if errors.Is(err, services.ErrNoCopyAvailable) {
+				c.JSON(400, gin.H{
+					"error":    err.Error(),
+					"waitlist": "/books/" + idStr + "/waitlist",
+				})
+				return
+			}
 			if err != nil {
-				c.JSON(400, gin.H{"error": err.Error()})
+				policyError(c, err)
 				return
 			}
 
 			c.JSON(200, gin.H{"message": "Книга успешно забронирована"})
 		})
 
-		books.POST("/:id/return", func(c *gin.Context) {
+		// Очередь целиком видят сотрудники выдачи, читатель - только
+		// её длину и своё место
+		books.GET("/:id/waitlist", auth.Require(auth.PermCirculationSelf), func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
+			}
+
+			entries := library.GetWaitlist(bookID)
+			claims, _ := auth.Identity(c)
+			if c.Query("user_email") == "" && claims.Can(auth.PermCirculationManage) {
+				c.JSON(200, gin.H{
+					"success": true,
+					"data":    entries,
+					"count":   len(entries),
+				})
+				return
+			}
+
+			userEmail, ok := actingEmail(c, c.Query("user_email"), auth.PermCirculationManage)
+			if !ok {
+				return
+			}
+			response := gin.H{"success": true, "count": len(entries)}
+			if position, err := library.WaitlistPosition(bookID, userEmail); err == nil {
+				response["position"] = position
+			}
+			c.JSON(200, response)
+		})
+
+		books.POST("/:id/waitlist", auth.Require(auth.PermCirculationSelf), func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
+			}
+
+			var req dto.WaitlistRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+			userEmail, ok := actingEmail(c, req.UserEmail, auth.PermCirculationManage)
+			if !ok {
+				return
+			}
+
+			position, err := library.JoinWaitlist(bookID, userEmail)
+			if err != nil {
+				policyError(c, err)
+				return
+			}
+
+			c.JSON(201, gin.H{
+				"message":  "Вы в очереди на книгу",
+				"position": position,
+			})
+		})
+
+		books.POST("/:id/waitlist/leave", auth.Require(auth.PermCirculationSelf), func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
+			}
+
+			var req dto.WaitlistRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+			userEmail, ok := actingEmail(c, req.UserEmail, auth.PermCirculationManage)
+			if !ok {
+				return
+			}
+
+			if err := library.LeaveWaitlist(bookID, userEmail); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{"message": "Вы покинули очередь"})
+		})
+
+		books.POST("/:id/checkout", auth.Require(auth.PermCirculationManage), func(c *gin.Context) {
 			idStr := c.Param("id")
 			bookID, err := strconv.Atoi(idStr)
 			if err != nil {
@@ -125,16 +352,47 @@ func SetupRouter(library *services.Library) *gin.Engine {
 				return
 			}
 
-			var req struct {
-				UserEmail string `json:"user_email" binding:"required"`
+			var req dto.CheckoutBookRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+			userEmail, ok := actingEmail(c, req.UserEmail, auth.PermCirculationManage)
+			if !ok {
+				return
+			}
+
+			loan, err := library.CheckoutBook(bookID, userEmail, req.Days, req.CopyID)
+			if err != nil {
+				policyError(c, err)
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Книга выдана",
+				"data":    loan,
+			})
+		})
+
+		books.POST("/:id/return", auth.Require(auth.PermCirculationManage), func(c *gin.Context) {
+			idStr := c.Param("id")
+			bookID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID книги"})
+				return
 			}
 
+			var req dto.ReturnBookRequest
 			if err := c.ShouldBindJSON(&req); err != nil {
 				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
 				return
 			}
+			userEmail, ok := actingEmail(c, req.UserEmail, auth.PermCirculationManage)
+			if !ok {
+				return
+			}
 
-			err = library.ReturnBook(bookID, req.UserEmail)
+			err = library.ReturnBook(bookID, userEmail, req.CopyID)
 			if err != nil {
 				c.JSON(400, gin.H{"error": err.Error()})
 				return
@@ -143,7 +401,7 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			c.JSON(200, gin.H{"message": "Книга успешно возвращена"})
 		})
 
-		books.PUT("/:id/update", func(c *gin.Context) {
+		books.PUT("/:id/update", auth.Require(auth.PermCatalogWrite), func(c *gin.Context) {
 			idStr := c.Param("id")
 			id, err := strconv.Atoi(idStr)
 			if err != nil {
@@ -166,7 +424,7 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			c.JSON(200, gin.H{"message": "Книга успешно обновлена"})
 		})
 
-		books.DELETE("/:id/delete", func(c *gin.Context) {
+		books.DELETE("/:id/delete", auth.Require(auth.PermCatalogWrite), func(c *gin.Context) {
 			idStr := c.Param("id")
 			id, err := strconv.Atoi(idStr)
 			if err != nil {
@@ -181,6 +439,10 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			}
 
 			err = library.DeleteBook(id)
+			if errors.Is(err, services.ErrBookInUse) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
 			if err != nil {
 				c.JSON(400, gin.H{"error": err.Error()})
 				return
@@ -202,14 +464,19 @@ func SetupRouter(library *services.Library) *gin.Engine {
 			})
 		})
 
-		authors.POST("/", func(c *gin.Context) {
+		authors.POST("/", auth.Require(auth.PermCatalogWrite), func(c *gin.Context) {
 			var req dto.CreateAuthorRequest
 			if err := c.ShouldBindJSON(&req); err != nil {
 				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
 				return
 			}
 
-			authorID := library.AddAuthor(req.Name, req.Email, req.Biography)
+			authorID, err := library.AddAuthor(req.Name, req.Email, req.Biography)
+			if err != nil {
+				c.JSON(500, gin.H{"error": err.Error()})
+				return
+			}
+
 			c.JSON(201, gin.H{
 				"message":   "Автор успешно добавлен",
 				"author_id": authorID,
@@ -234,12 +501,11 @@ func SetupRouter(library *services.Library) *gin.Engine {
 	}
 
 	// Reservations endpoints
-	reservations := router.Group("/reservations")
+	reservations := router.Group("/reservations", auth.Require(auth.PermCirculationSelf))
 	{
 		reservations.GET("/", func(c *gin.Context) {
-			userEmail := c.Query("user_email")
-			if userEmail == "" {
-				c.JSON(400, gin.H{"error": "Необходим параметр user_email"})
+			userEmail, ok := actingEmail(c, c.Query("user_email"), auth.PermCirculationManage)
+			if !ok {
 				return
 			}
 
@@ -263,7 +529,11 @@ func SetupRouter(library *services.Library) *gin.Engine {
 				return
 			}
 
-			err = library.CancelReservation(reservationID)
+			err = library.CancelReservation(reservationID, ownerFilter(c))
+			if errors.Is(err, services.ErrNotOwner) {
+				auth.Forbidden(c, err.Error())
+				return
+			}
 			if err != nil {
 				c.JSON(400, gin.H{"error": err.Error()})
 				return
@@ -271,32 +541,846 @@ func SetupRouter(library *services.Library) *gin.Engine {
 
 			c.JSON(200, gin.H{"message": "Бронь успешно отменена"})
 		})
+
+		reservations.POST("/:id/renew", func(c *gin.Context) {
+			idStr := c.Param("id")
+			reservationID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID бронирования"})
+				return
+			}
+
+			var req dto.RenewRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+
+			reservation, err := library.RenewReservation(reservationID, ownerFilter(c), req.Days)
+			if err != nil {
+				policyError(c, err)
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Бронь продлена",
+				"data":    reservation,
+			})
+		})
 	}
 
-	// Search endpoint
-	router.GET("/search/books", func(c *gin.Context) {
-		query := c.Query("q")
-		if query == "" {
-			c.JSON(400, gin.H{"error": "Необходим поисковый запрос (q)"})
-			return
-		}
+	// Loans endpoints
+	loans := router.Group("/loans", auth.Require(auth.PermCirculationSelf))
+	{
+		loans.GET("/", func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Query("user_email"), auth.PermCirculationManage)
+			if !ok {
+				return
+			}
 
-		results := library.SearchBooks(query)
-		c.JSON(200, gin.H{
-			"success": true,
-			"data":    results,
-			"count":   len(results),
+			userLoans := library.GetUserLoans(userEmail)
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    userLoans,
+				"count":   len(userLoans),
+			})
 		})
-	})
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"success": true,
-			"message": "Библиотека API работает",
-			"version": "1.0.0",
+		loans.POST("/:id/renew", func(c *gin.Context) {
+			idStr := c.Param("id")
+			loanID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID выдачи"})
+				return
+			}
+
+			var req dto.RenewRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+
+			loan, err := library.RenewLoan(loanID, ownerFilter(c), req.Days)
+			if err != nil {
+				policyError(c, err)
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Выдача продлена",
+				"data":    loan,
+			})
 		})
-	})
+	}
 
-	return router
+	// Patrons endpoints
+	patrons := router.Group("/patrons")
+	{
+		patrons.GET("/", auth.Require(auth.PermPatronsManage), func(c *gin.Context) {
+			if card := c.Query("card"); card != "" {
+				patron, err := library.FindPatronByCard(card)
+				if err != nil {
+					c.JSON(404, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(200, gin.H{"success": true, "data": patron})
+				return
+			}
+
+			all := library.GetAllPatrons()
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    all,
+				"count":   len(all),
+			})
+		})
+
+		patrons.POST("/", func(c *gin.Context) {
+			var req dto.CreatePatronRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			patron, err := library.RegisterPatron(req)
+			if errors.Is(err, services.ErrAccountExists) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(201, gin.H{
+				"message": "Читатель зарегистрирован",
+				"data":    patron,
+			})
+		})
+
+		patrons.GET("/:email", auth.Required(), func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Param("email"), auth.PermPatronsManage)
+			if !ok {
+				return
+			}
+
+			patron, err := library.FindPatron(userEmail)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": patron})
+		})
+
+		patrons.PUT("/:email", auth.Required(), func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Param("email"), auth.PermPatronsManage)
+			if !ok {
+				return
+			}
+
+			var req dto.UpdatePatronRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+			// Статус, категорию и срок билета меняют только сотрудники
+			claims, _ := auth.Identity(c)
+			if (req.Status != nil || req.Category != nil || req.Renew) && !claims.Can(auth.PermPatronsManage) {
+				auth.Forbidden(c, "статус, категорию и срок билета меняет библиотекарь")
+				return
+			}
+
+			patron, err := library.UpdatePatron(userEmail, req)
+			if errors.Is(err, services.ErrUnknownPatron) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Данные читателя обновлены",
+				"data":    patron,
+			})
+		})
+
+		patrons.POST("/:email/deactivate", auth.Require(auth.PermPatronsManage), func(c *gin.Context) {
+			err := library.DeactivatePatron(c.Param("email"))
+			if errors.Is(err, services.ErrUnknownPatron) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{"message": "Читательский билет заблокирован"})
+		})
+
+		patrons.GET("/:email/fines", auth.Required(), func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Param("email"), auth.PermFinesManage)
+			if !ok {
+				return
+			}
+
+			fines := library.GetPatronFines(userEmail)
+			c.JSON(200, gin.H{
+				"success":         true,
+				"data":            fines,
+				"balance_display": fines.Balance.String(),
+			})
+		})
+
+		patrons.GET("/:email/notifications", auth.Required(), func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Param("email"), auth.PermPatronsManage)
+			if !ok {
+				return
+			}
+
+			prefs, err := library.NotificationPreferences(userEmail)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": prefs})
+		})
+
+		patrons.PUT("/:email/notifications", auth.Required(), func(c *gin.Context) {
+			userEmail, ok := actingEmail(c, c.Param("email"), auth.PermPatronsManage)
+			if !ok {
+				return
+			}
+
+			var req dto.UpdateNotificationPreferencesRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			prefs, err := library.UpdateNotificationPreferences(userEmail, req)
+			if errors.Is(err, services.ErrUnknownPatron) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{
+				"message": "Настройки уведомлений обновлены",
+				"data":    prefs,
+			})
+		})
+	}
+
+	// Отписка по ссылке из письма работает без входа: право на неё
+	// подтверждает подпись токена. GET только показывает форму
+	// подтверждения - ссылки открывают и почтовые сканеры; отписывает
+	// POST из формы или из почтового клиента (RFC 8058, в один клик).
+	router.GET("/unsubscribe", func(c *gin.Context) {
+		token := c.Query("token")
+		_, event, err := signer.VerifyUnsubscribe(token)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Неверная ссылка отписки"})
+			return
+		}
+
+		c.Status(200)
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		unsubscribePage.Execute(c.Writer, gin.H{"Token": token, "Event": event})
+	})
+	router.POST("/unsubscribe", func(c *gin.Context) {
+		email, event, err := signer.VerifyUnsubscribe(c.Query("token"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Неверная ссылка отписки"})
+			return
+		}
+
+		err = library.Unsubscribe(email, event)
+		if errors.Is(err, services.ErrUnknownPatron) {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		message := "Вы отписались от всех писем библиотеки"
+		if event != "" {
+			message = "Вы отписались от писем этого типа"
+		}
+		c.JSON(200, gin.H{"success": true, "message": message, "event": event})
+	})
+
+	fines := router.Group("/fines", auth.Require(auth.PermFinesManage))
+	{
+		fines.POST("/:id/pay", func(c *gin.Context) {
+			idStr := c.Param("id")
+			fineID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID штрафа"})
+				return
+			}
+
+			var req dto.PayFineRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+
+			fine, err := library.PayFine(fineID, req.Amount)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Оплата принята",
+				"data":    fine,
+			})
+		})
+
+		fines.POST("/:id/waive", func(c *gin.Context) {
+			idStr := c.Param("id")
+			fineID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID штрафа"})
+				return
+			}
+
+			var req dto.WaiveFineRequest
+			if c.Request.ContentLength > 0 {
+				if err := c.ShouldBindJSON(&req); err != nil {
+					c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+					return
+				}
+			}
+
+			fine, err := library.WaiveFine(fineID, req.Amount, req.Reason)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Штраф списан",
+				"data":    fine,
+			})
+		})
+	}
+
+	// Staff endpoints
+	staff := router.Group("/staff", auth.Require(auth.PermStaffManage))
+	{
+		staff.GET("/", func(c *gin.Context) {
+			accounts := library.GetStaffAccounts()
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    accounts,
+				"count":   len(accounts),
+			})
+		})
+
+		staff.POST("/", func(c *gin.Context) {
+			var req dto.CreateStaffRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			account, err := library.CreateStaffAccount(req.Email, req.Password, req.Role)
+			if errors.Is(err, services.ErrAccountExists) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(201, gin.H{
+				"message": "Сотрудник добавлен",
+				"data":    account,
+			})
+		})
+
+		staff.PUT("/:email/role", func(c *gin.Context) {
+			var req dto.SetRoleRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			account, err := library.SetAccountRole(c.Param("email"), req.Role)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "Роль изменена",
+				"data":    account,
+			})
+		})
+	}
+
+	// API keys endpoints
+	apiKeys := router.Group("/apikeys", auth.Require(auth.PermAPIKeysManage))
+	{
+		apiKeys.GET("/", func(c *gin.Context) {
+			keys := library.GetAPIKeys()
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    keys,
+				"count":   len(keys),
+			})
+		})
+
+		apiKeys.POST("/", func(c *gin.Context) {
+			var req dto.CreateAPIKeyRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			claims, _ := auth.Identity(c)
+			secret, key, err := library.CreateAPIKey(req.Name, req.Scopes, claims.Subject)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(201, gin.H{
+				"message": "API-ключ создан. Сохраните его: больше он показан не будет",
+				"key":     secret,
+				"data":    key,
+			})
+		})
+
+		apiKeys.POST("/:id/revoke", func(c *gin.Context) {
+			idStr := c.Param("id")
+			keyID, err := strconv.Atoi(idStr)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID ключа"})
+				return
+			}
+
+			key, err := library.RevokeAPIKey(keyID)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"message": "API-ключ отозван",
+				"data":    key,
+			})
+		})
+	}
+
+	// Webhook endpoints
+	webhooks := router.Group("/webhooks", auth.Require(auth.PermWebhooksManage))
+	{
+		webhookID := func(c *gin.Context) (int, bool) {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID подписки"})
+				return 0, false
+			}
+			return id, true
+		}
+		webhookError := func(c *gin.Context, err error) {
+			if errors.Is(err, services.ErrUnknownWebhook) || errors.Is(err, services.ErrUnknownDelivery) {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(400, gin.H{"error": err.Error()})
+		}
+
+		webhooks.GET("/", func(c *gin.Context) {
+			list := library.GetWebhooks()
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    list,
+				"count":   len(list),
+				"events":  models.WebhookEvents,
+			})
+		})
+
+		webhooks.POST("/", func(c *gin.Context) {
+			var req dto.CreateWebhookRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			claims, _ := auth.Identity(c)
+			webhook, err := library.CreateWebhook(req, claims.Subject)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(201, gin.H{
+				"message": "Подписка создана. Сохраните секрет: больше он показан не будет",
+				"data":    webhook,
+			})
+		})
+
+		webhooks.GET("/:id", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			webhook, err := library.FindWebhook(id)
+			if err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": webhook})
+		})
+
+		webhooks.PUT("/:id", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			var req dto.UpdateWebhookRequest
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+				return
+			}
+
+			webhook, err := library.UpdateWebhook(id, req)
+			if err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(200, gin.H{"message": "Подписка обновлена", "data": webhook})
+		})
+
+		webhooks.DELETE("/:id", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			if err := library.DeleteWebhook(id); err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(200, gin.H{"message": "Подписка удалена"})
+		})
+
+		webhooks.POST("/:id/ping", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			delivery, err := library.PingWebhook(id)
+			if err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(202, gin.H{"message": "Проверочная доставка поставлена в очередь", "data": delivery})
+		})
+
+		webhooks.GET("/:id/deliveries", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			deliveries, err := library.WebhookDeliveries(id)
+			if err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    deliveries,
+				"count":   len(deliveries),
+			})
+		})
+
+		webhooks.POST("/:id/deliveries/:delivery/redeliver", func(c *gin.Context) {
+			id, ok := webhookID(c)
+			if !ok {
+				return
+			}
+			deliveryID, err := strconv.Atoi(c.Param("delivery"))
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID доставки"})
+				return
+			}
+
+			delivery, err := library.RedeliverWebhook(id, deliveryID)
+			if err != nil {
+				webhookError(c, err)
+				return
+			}
+			c.JSON(202, gin.H{"message": "Доставка поставлена в очередь повторно", "data": delivery})
+		})
+	}
+
+	// Notification endpoints
+	notifications := router.Group("/notifications", auth.Require(auth.PermNotificationsManage))
+	{
+		notifications.GET("/templates", func(c *gin.Context) {
+			c.JSON(200, gin.H{
+				"success": true,
+				"data": gin.H{
+					"events":    templates.Events,
+					"languages": templates.Languages,
+				},
+			})
+		})
+
+		notifications.GET("/preview", func(c *gin.Context) {
+			event := c.Query("event")
+			lang := c.DefaultQuery("lang", templates.DefaultLang)
+
+			msg, err := library.PreviewNotification(event, lang)
+			if err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			if c.Query("format") == "html" && msg.HTML != "" {
+				c.Data(200, "text/html; charset=utf-8", []byte(msg.HTML))
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": msg})
+		})
+
+		notifications.POST("/templates/reload", func(c *gin.Context) {
+			if err := library.Templates.Reload(); err != nil {
+				c.JSON(400, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "message": "Шаблоны писем перечитаны"})
+		})
+
+		delivery := notifications.Group("", auth.Require(auth.PermConfigManage))
+
+		delivery.GET("/dead", func(c *gin.Context) {
+			dead := library.DeadLetters()
+			c.JSON(200, gin.H{
+				"success": true,
+				"data":    dead,
+				"count":   len(dead),
+			})
+		})
+
+		delivery.GET("/:id", func(c *gin.Context) {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID уведомления"})
+				return
+			}
+
+			notification, err := library.FindNotification(id)
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": notification})
+		})
+
+		delivery.POST("/:id/requeue", func(c *gin.Context) {
+			id, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверный ID уведомления"})
+				return
+			}
+
+			notification, err := library.RequeueNotification(id)
+			if errors.Is(err, services.ErrNotDeadLetter) {
+				c.JSON(409, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.JSON(404, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(200, gin.H{
+				"success": true,
+				"message": "Письмо снова поставлено в очередь",
+				"data":    notification,
+			})
+		})
+	}
+
+	router.GET("/config", auth.Require(auth.PermConfigManage), func(c *gin.Context) {
+		settings, err := cfg.Redacted().Map()
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    settings,
+		})
+	})
+
+	// Счётчики зафиксированных доменных событий с запуска
+	router.GET("/events", auth.Require(auth.PermConfigManage), func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    library.Events.Stats(),
+		})
+	})
+
+	// Policy endpoints
+	router.GET("/policy", auth.Require(auth.PermConfigManage), func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    library.Policy.Config(),
+		})
+	})
+
+	router.POST("/policy/reload", auth.Require(auth.PermConfigManage), func(c *gin.Context) {
+		if err := library.Policy.Reload(); err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"message": "Правила выдачи перечитаны",
+			"data":    library.Policy.Config(),
+		})
+	})
+
+	// Dev endpoints: симулированные часы, только с dev.time_travel
+	if sim, ok := library.Clock.(*clock.Simulated); ok && cfg.Dev.TimeTravel {
+		setupDevRoutes(router, library, sim)
+	}
+
+	// Search endpoint
+	router.GET("/search/books", func(c *gin.Context) {
+		query := c.Query("q")
+		if query == "" {
+			c.JSON(400, gin.H{"error": "Необходим поисковый запрос (q)"})
+			return
+		}
+
+		results := library.SearchBooks(query)
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    results,
+			"count":   len(results),
+		})
+	})
+
+	// Health check
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Библиотека API работает",
+			"version": "1.0.0",
+		})
+	})
+
+	return router
+}
+
+// unsubscribePage - форма подтверждения отписки для GET /unsubscribe.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Отписка от писем</title></head>
+<body>
+<p>{{if .Event}}Отписаться от писем этого типа?{{else}}Отписаться от всех писем библиотеки?{{end}}</p>
+<form method="post" action="/unsubscribe?token={{.Token}}">
+<button type="submit">Отписаться</button>
+</form>
+</body>
+</html>
+`))
+
+// rateGroup относит запрос к группе маршрутов со своим лимитом.
+func rateGroup(c *gin.Context) string {
+	path := c.FullPath()
+	switch {
+	case strings.HasPrefix(path, "/auth/"), path == "/unsubscribe":
+		return "auth"
+	case strings.HasPrefix(path, "/search/"), path == "/books/search/advanced":
+		return "search"
+	case strings.HasPrefix(path, "/reservations"), strings.HasPrefix(path, "/loans"),
+		c.Request.Method == "POST" && (strings.HasSuffix(path, "/reserve") ||
+			strings.HasSuffix(path, "/checkout") || strings.HasSuffix(path, "/return") ||
+			strings.Contains(path, "/waitlist")):
+		return "circulation"
+	}
+	return "default"
+}
+
+// rateClient - кому засчитывается запрос: API-ключу, вошедшему
+// пользователю или, для анонимов, IP-адресу.
+func rateClient(c *gin.Context) string {
+	if claims, ok := auth.Identity(c); ok {
+		return "user:" + claims.Subject
+	}
+	return clientIP(c)
+}
+
+func clientIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// actingEmail возвращает читателя, от имени которого выполняется запрос:
+// указанного в запросе, если у пользователя есть право staff, иначе
+// владельца токена. Чужой email без этого права - 403.
+func actingEmail(c *gin.Context, requested string, staff auth.Permission) (string, bool) {
+	claims, ok := auth.Identity(c)
+	if !ok {
+		c.JSON(401, gin.H{"error": "требуется вход в систему"})
+		return "", false
+	}
+	if requested == "" || requested == claims.Subject {
+		return claims.Subject, true
+	}
+	if !claims.Can(staff) {
+		auth.Forbidden(c, "нельзя действовать от имени другого читателя")
+		return "", false
+	}
+	return requested, true
+}
+
+// ownerFilter - email, по которому проверяется владелец брони или выдачи.
+// Сотрудникам выдачи проверка не нужна.
+func ownerFilter(c *gin.Context) string {
+	claims, _ := auth.Identity(c)
+	if claims.Can(auth.PermCirculationManage) {
+		return ""
+	}
+	return claims.Subject
+}
+
+// policyError отвечает с кодом причины, если операцию отклонили правила
+// выдачи (403 - чужая запись или читатель не может брать книги,
+// 409 - прочие отказы),
+// и 400 на прочие ошибки.
+func policyError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrNotOwner) {
+		auth.Forbidden(c, err.Error())
+		return
+	}
+
+	var denied *policy.Violation
+	if errors.As(err, &denied) {
+		status := 409
+		if denied.Reason == policy.ReasonUnknownPatron || denied.Reason == policy.ReasonPatronInactive {
+			status = 403
+		}
+		c.JSON(status, gin.H{
+			"error":  denied.Message,
+			"reason": denied.Reason,
+		})
+		return
+	}
+	c.JSON(400, gin.H{"error": err.Error()})
 }
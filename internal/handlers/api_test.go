@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"library-app/internal/auth"
+	"library-app/internal/config"
+	"library-app/internal/email"
+	"library-app/internal/models"
+	"library-app/internal/ratelimit"
+	"library-app/internal/services"
+	"library-app/internal/storage"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestRouter(t *testing.T, cfg config.Config) (*gin.Engine, *services.Library, *auth.Signer) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	library := services.NewLibrary(storage.NewMemoryStore(), services.Options{
+		Mailer:             email.NewFake(),
+		EmailWorkers:       1,
+		EmailQueue:         10,
+		ReservationWorkers: 1,
+		ReservationQueue:   10,
+	})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		library.Shutdown(ctx)
+	})
+	signer := auth.NewSigner("test-secret", time.Hour)
+	return SetupRouter(library, signer, cfg), library, signer
+}
+
+// request выполняет запрос к API от имени пользователя с токеном token
+// (пустой - анонимно) и разбирает JSON-ответ.
+func request(t *testing.T, router *gin.Engine, method, path, token, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s %s: ответ не JSON: %s", method, path, w.Body)
+	}
+	return w.Code, resp
+}
+
+func issue(t *testing.T, signer *auth.Signer, subject, role string) string {
+	t.Helper()
+	token, _, err := signer.Issue(subject, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSelfRegistrationCannotChooseCategory(t *testing.T) {
+	router, library, signer := newTestRouter(t, config.Default())
+
+	code, resp := request(t, router, "POST", "/patrons/", "", `{
+		"name": "Иван", "email": "reader@example.com", "password": "secret-password",
+		"category": "student"
+	}`)
+	if code != http.StatusCreated {
+		t.Fatalf("регистрация: %d %v", code, resp)
+	}
+	patron, err := library.FindPatron("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patron.Category != models.DefaultPatronCategory {
+		t.Fatalf("анонимная регистрация выбрала категорию %q", patron.Category)
+	}
+
+	// Сам читатель категорию не меняет, библиотекарь - меняет
+	update := `{"category": "student"}`
+	reader := issue(t, signer, "reader@example.com", models.RolePatron)
+	if code, resp := request(t, router, "PUT", "/patrons/reader@example.com", reader, update); code != http.StatusForbidden {
+		t.Fatalf("читатель меняет свою категорию: %d %v", code, resp)
+	}
+	librarian := issue(t, signer, "librarian@example.com", models.RoleLibrarian)
+	if code, resp := request(t, router, "PUT", "/patrons/reader@example.com", librarian, update); code != http.StatusOK {
+		t.Fatalf("библиотекарь меняет категорию: %d %v", code, resp)
+	}
+	patron, err = library.FindPatron("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patron.Category != "student" {
+		t.Fatalf("категория после изменения библиотекарем: %q", patron.Category)
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Default = ratelimit.Limit{RatePerMinute: 1, Burst: 2}
+	router, _, signer := newTestRouter(t, cfg)
+	reader := issue(t, signer, "reader@example.com", models.RolePatron)
+	other := issue(t, signer, "other@example.com", models.RolePatron)
+
+	// Анонимы с одного IP делят бюджет
+	for i := range 2 {
+		if code, resp := request(t, router, "GET", "/books/", "", ""); code != http.StatusOK {
+			t.Fatalf("анонимный запрос %d: %d %v", i+1, code, resp)
+		}
+	}
+	if code, _ := request(t, router, "GET", "/books/", "", ""); code != http.StatusTooManyRequests {
+		t.Fatalf("анонимный запрос сверх лимита: %d", code)
+	}
+
+	// У вошедших с того же IP свой бюджет у каждого
+	for i := range 2 {
+		if code, resp := request(t, router, "GET", "/books/", reader, ""); code != http.StatusOK {
+			t.Fatalf("запрос читателя %d: %d %v", i+1, code, resp)
+		}
+	}
+	if code, _ := request(t, router, "GET", "/books/", reader, ""); code != http.StatusTooManyRequests {
+		t.Fatalf("запрос читателя сверх лимита: %d", code)
+	}
+	if code, resp := request(t, router, "GET", "/books/", other, ""); code != http.StatusOK {
+		t.Fatalf("запрос другого читателя: %d %v", code, resp)
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"library-app/internal/auth"
+	"library-app/internal/clock"
+	"library-app/internal/dto"
+	"library-app/internal/services"
+	"time"
+)
+
+// setupDevRoutes - управление симулированными часами для тестов
+// истечения броней и просрочек. Подключается только при dev.time_travel.
+func setupDevRoutes(router *gin.Engine, library *services.Library, sim *clock.Simulated) {
+	dev := router.Group("/dev", auth.Require(auth.PermConfigManage))
+
+	clockState := func() gin.H {
+		return gin.H{
+			"now":    sim.Now(),
+			"offset": sim.Offset().String(),
+		}
+	}
+
+	dev.GET("/clock", func(c *gin.Context) {
+		c.JSON(200, gin.H{"success": true, "data": clockState()})
+	})
+
+	dev.POST("/clock/advance", func(c *gin.Context) {
+		var req dto.AdvanceClockRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Неверные данные: " + err.Error()})
+			return
+		}
+
+		var d time.Duration
+		if req.Duration != "" {
+			parsed, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Неверная длительность: " + req.Duration})
+				return
+			}
+			d = parsed
+		}
+		d += time.Duration(req.Days) * 24 * time.Hour
+
+		if _, err := sim.Advance(d); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		library.ProcessExpiredReservations()
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Часы переведены, просрочки обработаны",
+			"data":    clockState(),
+		})
+	})
+
+	dev.POST("/expirations/run", func(c *gin.Context) {
+		library.ProcessExpiredReservations()
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Просрочки обработаны",
+			"data":    clockState(),
+		})
+	})
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	RolePatron    = "patron"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
+func ValidRole(role string) bool {
+	return role == RolePatron || role == RoleLibrarian || role == RoleAdmin
+}
+
+// Account - учётная запись для входа в API. Пароль хранится только
+// в виде bcrypt-хеша.
+type Account struct {
+	ID           int       `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"` // "patron", "librarian", "admin"
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
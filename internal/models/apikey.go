@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// APIKey - ключ доступа для автоматических клиентов (киоски, отчёты).
+// Сам ключ показывается один раз при создании, хранится только его хеш.
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"key_hash"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k APIKey) IsActive() bool {
+	return k.RevokedAt == nil
+}
@@ -0,0 +1,37 @@
+package models
+
+import "fmt"
+
+const (
+	CopyAvailable = "available"
+	CopyReserved  = "reserved"
+	CopyOnLoan    = "on_loan"
+	CopyLost      = "lost"
+)
+
+// Тип экземпляра, если он не указан при добавлении
+const DefaultItemType = "book"
+
+// Copy - физический экземпляр книги.
+type Copy struct {
+	ID       int    `json:"id"`
+	BookID   int    `json:"book_id"`
+	Barcode  string `json:"barcode"`
+	Branch   string `json:"branch"`
+	Location string `json:"location"`
+	ItemType string `json:"item_type"`
+	Status   string `json:"status"` // "available", "reserved", "on_loan", "lost"
+}
+
+func (c Copy) IsAvailable() bool {
+	return c.Status == CopyAvailable
+}
+
+func (c Copy) String() string {
+	return fmt.Sprintf("%s (%s, %s) [%s]", c.Barcode, c.Branch, c.Location, c.Status)
+}
+
+// DefaultBarcode - штрихкод n-го экземпляра книги, если его не задали явно.
+func DefaultBarcode(bookID, n int) string {
+	return fmt.Sprintf("LIB-%05d-%02d", bookID, n)
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Money - сумма в копейках. Деньги никогда не храним во float.
+type Money int64
+
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return fmt.Sprintf("%s%d.%02d ₽", sign, m/100, m%100)
+}
+
+const (
+	FineOpen   = "open"
+	FinePaid   = "paid"
+	FineWaived = "waived"
+)
+
+// Fine - штраф за просрочку одной выдачи. Amount растёт по мере просрочки,
+// Paid и Waived - оплаченная и списанная части.
+type Fine struct {
+	ID        int       `json:"id"`
+	LoanID    int       `json:"loan_id"`
+	UserEmail string    `json:"user_email"`
+	Amount    Money     `json:"amount"`
+	Paid      Money     `json:"paid"`
+	Waived    Money     `json:"waived"`
+	Status    string    `json:"status"` // "open", "paid", "waived"
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (f Fine) Outstanding() Money {
+	return f.Amount - f.Paid - f.Waived
+}
+
+const (
+	LedgerCharge  = "charge"
+	LedgerPayment = "payment"
+	LedgerWaiver  = "waiver"
+)
+
+// LedgerEntry - строка журнала расчётов читателя. Записи только добавляются.
+type LedgerEntry struct {
+	ID        int       `json:"id"`
+	FineID    int       `json:"fine_id"`
+	UserEmail string    `json:"user_email"`
+	Type      string    `json:"type"` // "charge", "payment", "waiver"
+	Amount    Money     `json:"amount"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	LoanActive   = "active"
+	LoanReturned = "returned"
+)
+
+// Loan - выдача экземпляра читателю на руки.
+type Loan struct {
+	ID            int        `json:"id"`
+	BookID        int        `json:"book_id"`
+	CopyID        int        `json:"copy_id"`
+	ReservationID int        `json:"reservation_id,omitempty"`
+	UserEmail     string     `json:"user_email"`
+	CheckoutDate  time.Time  `json:"checkout_date"`
+	DueDate       time.Time  `json:"due_date"`
+	ReturnDate    *time.Time `json:"return_date,omitempty"`
+	Renewals      int        `json:"renewals"`
+	// RemindedAt - когда отправлено напоминание о скором сроке возврата
+	RemindedAt *time.Time `json:"reminded_at,omitempty"`
+	Status     string     `json:"status"` // "active", "returned"
+}
+
+func (l Loan) IsOverdue(now time.Time) bool {
+	return l.Status == LoanActive && l.DueDate.Before(now)
+}
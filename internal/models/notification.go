@@ -1,7 +1,32 @@
 package models
 
+import "time"
+
+const (
+	// NotificationPending - записано в исходящие, ждёт очереди отправки
+	NotificationPending = "pending"
+	// NotificationQueued - забрано в очередь в памяти в QueuedAt
+	NotificationQueued = "queued"
+	// NotificationRetrying - отправка не удалась, повтор в NextAttemptAt
+	NotificationRetrying = "retrying"
+	NotificationSent     = "sent"
+	// NotificationDead - попытки исчерпаны или ошибка постоянная
+	NotificationDead = "dead"
+	// NotificationDropped - старые письма, отброшенные при переполнении очереди
+	NotificationDropped = "dropped"
+)
+
 type EmailNotification struct {
-	To      string `json:"to"`
-	Subject string `json:"subject"`
-	Message string `json:"message"`
+	ID            int        `json:"id"`
+	To            string     `json:"to"`
+	Subject       string     `json:"subject"`
+	Message       string     `json:"message"`
+	HTML          string     `json:"html,omitempty"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	QueuedAt      *time.Time `json:"queued_at,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
 }
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Категория читателя, если она не указана при регистрации
+const DefaultPatronCategory = "standard"
+
+const (
+	PatronActive    = "active"
+	PatronSuspended = "suspended"
+	PatronExpired   = "expired"
+)
+
+// Patron - зарегистрированный читатель библиотеки.
+type Patron struct {
+	ID int `json:"id"`
+	Person
+	CardNumber    string                  `json:"card_number"`
+	Phone         string                  `json:"phone"`
+	Address       string                  `json:"address"`
+	Category      string                  `json:"category"`
+	Language      string                  `json:"language"` // язык писем: "ru" или "en"
+	Notifications NotificationPreferences `json:"notifications"`
+	Status        string                  `json:"status"` // "active", "suspended", "expired"
+	RegisteredAt  time.Time               `json:"registered_at"`
+	ExpiresAt     time.Time               `json:"expires_at"`
+}
+
+func (p Patron) IsActive(now time.Time) bool {
+	return p.Status == PatronActive && now.Before(p.ExpiresAt)
+}
+
+func CardNumber(patronID int) string {
+	return fmt.Sprintf("CARD-%06d", patronID)
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Каналы уведомлений. Пока письма уходят только по почте, "none"
+// отключает их совсем.
+const (
+	ChannelEmail = "email"
+	ChannelNone  = "none"
+)
+
+// NotificationPreferences - какие письма и когда получает читатель.
+// Хранятся отключённые события, чтобы новые типы писем приходили
+// по умолчанию.
+type NotificationPreferences struct {
+	Muted   []string `json:"muted"`
+	Channel string   `json:"channel"`
+	// QuietStart и QuietEnd - "тихие часы" в формате "22:00", письма
+	// за это время откладываются до их окончания. Интервал может
+	// переходить через полночь.
+	QuietStart string `json:"quiet_start,omitempty"`
+	QuietEnd   string `json:"quiet_end,omitempty"`
+}
+
+// Wants сообщает, хочет ли читатель получать письма о событии.
+func (p NotificationPreferences) Wants(event string) bool {
+	return p.Channel != ChannelNone && !slices.Contains(p.Muted, event)
+}
+
+// QuietUntil возвращает конец тихих часов, если now попадает в них.
+func (p NotificationPreferences) QuietUntil(now time.Time) (time.Time, bool) {
+	if p.QuietStart == "" || p.QuietEnd == "" {
+		return time.Time{}, false
+	}
+	start, err1 := ParseClock(p.QuietStart)
+	end, err2 := ParseClock(p.QuietEnd)
+	if err1 != nil || err2 != nil || start == end {
+		return time.Time{}, false
+	}
+
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	minute := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	switch {
+	case start < end && minute >= start && minute < end:
+		return day.Add(end), true
+	case start > end && minute >= start:
+		return day.AddDate(0, 0, 1).Add(end), true
+	case start > end && minute < end:
+		return day.Add(end), true
+	}
+	return time.Time{}, false
+}
+
+// ParseClock разбирает время суток "ЧЧ:ММ" в смещение от полуночи.
+func ParseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("время %q должно быть в формате ЧЧ:ММ", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistFulfilled = "fulfilled"
+	WaitlistCancelled = "cancelled"
+)
+
+// WaitlistEntry - место читателя в очереди на книгу.
+type WaitlistEntry struct {
+	ID            int       `json:"id"`
+	BookID        int       `json:"book_id"`
+	UserEmail     string    `json:"user_email"`
+	CreatedAt     time.Time `json:"created_at"`
+	Status        string    `json:"status"` // "waiting", "fulfilled", "cancelled"
+	ReservationID int       `json:"reservation_id,omitempty"`
+}
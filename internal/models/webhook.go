@@ -0,0 +1,66 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// События, о которых сообщают вебхуки.
+const (
+	WebhookReservationCreated   = "reservation.created"
+	WebhookReservationCancelled = "reservation.cancelled"
+	WebhookReservationExpired   = "reservation.expired"
+	WebhookBookCheckedOut       = "book.checked_out"
+	WebhookBookReturned         = "book.returned"
+	// WebhookPing - проверочная доставка, приходит всем подпискам
+	WebhookPing = "ping"
+)
+
+var WebhookEvents = []string{
+	WebhookReservationCreated, WebhookReservationCancelled, WebhookReservationExpired,
+	WebhookBookCheckedOut, WebhookBookReturned,
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead - попытки исчерпаны или получатель отклонил запрос
+	DeliveryDead = "dead"
+)
+
+// Webhook - подписка внешней системы на события библиотеки. Secret
+// подписывает тело запроса (HMAC-SHA256), наружу не отдаётся.
+// Пустой Events - все события.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w Webhook) Wants(event string) bool {
+	if !w.Active {
+		return false
+	}
+	return event == WebhookPing || len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// WebhookDelivery - одна доставка события подписке и её история попыток.
+// Payload - готовое тело запроса, при повторе отправляется как есть.
+type WebhookDelivery struct {
+	ID            int        `json:"id"`
+	WebhookID     int        `json:"webhook_id"`
+	Event         string     `json:"event"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
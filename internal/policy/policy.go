@@ -0,0 +1,244 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"library-app/internal/models"
+	"os"
+	"sync"
+	"time"
+)
+
+// Any в правиле подходит к любой категории читателя или типу экземпляра.
+const Any = "*"
+
+// Rule - правила выдачи для пары "категория читателя - тип экземпляра".
+// Сроки в днях, штрафы в копейках. MaxReservationDays и MaxLoanDays
+// ограничивают общий срок вместе с продлениями; MaxLoanDays = 0 означает,
+// что экземпляры этого типа на руки не выдаются.
+type Rule struct {
+	PatronCategory         string       `json:"patron_category"`
+	ItemType               string       `json:"item_type"`
+	MaxReservations        int          `json:"max_reservations"`
+	MaxLoans               int          `json:"max_loans"`
+	ReservationDays        int          `json:"reservation_days"`
+	MaxReservationDays     int          `json:"max_reservation_days"`
+	LoanDays               int          `json:"loan_days"`
+	MaxLoanDays            int          `json:"max_loan_days"`
+	MaxRenewals            int          `json:"max_renewals"`
+	ReservationRenewalDays int          `json:"reservation_renewal_days"`
+	LoanRenewalDays        int          `json:"loan_renewal_days"`
+	GraceDays              int          `json:"grace_days"`
+	FinePerDay             models.Money `json:"fine_per_day"`
+	FineCap                models.Money `json:"fine_cap"`
+}
+
+type Config struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Default повторяет правила, которые раньше были зашиты в код.
+func Default() Config {
+	return Config{Rules: []Rule{{
+		PatronCategory:         Any,
+		ItemType:               Any,
+		MaxReservations:        3,
+		MaxLoans:               5,
+		ReservationDays:        3,
+		MaxReservationDays:     14,
+		LoanDays:               14,
+		MaxLoanDays:            60,
+		MaxRenewals:            2,
+		ReservationRenewalDays: 3,
+		LoanRenewalDays:        14,
+		FinePerDay:             1000,
+		FineCap:                50000,
+	}}}
+}
+
+func (c Config) Validate() error {
+	hasDefault := false
+	for i, r := range c.Rules {
+		if r.PatronCategory == "" || r.ItemType == "" {
+			return fmt.Errorf("правило %d: не указаны patron_category и item_type", i+1)
+		}
+		if r.PatronCategory == Any && r.ItemType == Any {
+			hasDefault = true
+		}
+		for _, v := range []int{r.MaxReservations, r.MaxLoans, r.ReservationDays, r.MaxReservationDays,
+			r.LoanDays, r.MaxLoanDays, r.MaxRenewals, r.ReservationRenewalDays, r.LoanRenewalDays, r.GraceDays} {
+			if v < 0 {
+				return fmt.Errorf("правило %d (%s/%s): значения не могут быть отрицательными", i+1, r.PatronCategory, r.ItemType)
+			}
+		}
+		if r.FinePerDay < 0 || r.FineCap < 0 {
+			return fmt.Errorf("правило %d (%s/%s): штрафы не могут быть отрицательными", i+1, r.PatronCategory, r.ItemType)
+		}
+		if r.ReservationDays > r.MaxReservationDays || r.LoanDays > r.MaxLoanDays {
+			return fmt.Errorf("правило %d (%s/%s): срок по умолчанию больше максимального", i+1, r.PatronCategory, r.ItemType)
+		}
+	}
+	if !hasDefault {
+		return fmt.Errorf("нет правила по умолчанию (patron_category и item_type = %q)", Any)
+	}
+	return nil
+}
+
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("не удалось прочитать правила %s: %w", path, err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Config{}, fmt.Errorf("неверный формат правил %s: %w", path, err)
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Engine хранит действующие правила. Reload подменяет их целиком,
+// поэтому проверки никогда не видят наполовину загруженный файл.
+type Engine struct {
+	mu     sync.RWMutex
+	path   string
+	config Config
+}
+
+func NewEngine(c Config) *Engine {
+	return &Engine{config: c}
+}
+
+// LoadEngine читает правила из файла. Если файла нет, действуют правила
+// по умолчанию, а Reload подхватит файл, когда он появится.
+func LoadEngine(path string) (*Engine, error) {
+	e := &Engine{path: path, config: Default()}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return e, nil
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload перечитывает файл правил. При ошибке остаются прежние правила.
+func (e *Engine) Reload() error {
+	if e.path == "" {
+		return fmt.Errorf("файл правил не задан")
+	}
+	c, err := LoadConfig(e.path)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.config = c
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) Config() Config {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return Config{Rules: append([]Rule(nil), e.config.Rules...)}
+}
+
+// Rule выбирает самое точное правило: совпадение по обоим ключам,
+// затем по типу экземпляра, затем по категории, затем правило по умолчанию.
+// Тип экземпляра важнее: справочник не выдаётся на руки никому.
+func (e *Engine) Rule(category, itemType string) Rule {
+	if category == "" {
+		category = models.DefaultPatronCategory
+	}
+	if itemType == "" {
+		itemType = models.DefaultItemType
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	best, bestScore := Rule{}, -1
+	for _, r := range e.config.Rules {
+		score := 0
+		switch r.PatronCategory {
+		case category:
+			score++
+		case Any:
+		default:
+			continue
+		}
+		switch r.ItemType {
+		case itemType:
+			score += 2
+		case Any:
+		default:
+			continue
+		}
+		if score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
+
+// ReservationPeriod проверяет срок брони (0 - срок по умолчанию).
+func (r Rule) ReservationPeriod(days int) (int, error) {
+	if days == 0 {
+		days = r.ReservationDays
+	}
+	if days <= 0 {
+		return 0, Deny(ReasonBadDays, "срок брони должен быть положительным")
+	}
+	if days > r.MaxReservationDays {
+		return 0, Deny(ReasonMaxDuration, "бронь возможна не более чем на %d дн.", r.MaxReservationDays)
+	}
+	return days, nil
+}
+
+// LoanPeriod проверяет срок выдачи (0 - срок по умолчанию).
+func (r Rule) LoanPeriod(days int) (int, error) {
+	if r.MaxLoanDays == 0 {
+		return 0, Deny(ReasonNotLoanable, "экземпляры этого типа не выдаются на руки")
+	}
+	if days == 0 {
+		days = r.LoanDays
+	}
+	if days <= 0 {
+		return 0, Deny(ReasonBadDays, "срок выдачи должен быть положительным")
+	}
+	if days > r.MaxLoanDays {
+		return 0, Deny(ReasonMaxDuration, "выдача возможна не более чем на %d дн.", r.MaxLoanDays)
+	}
+	return days, nil
+}
+
+func (r Rule) CheckReservations(active int) error {
+	if active >= r.MaxReservations {
+		return Deny(ReasonMaxReservations, "достигнут лимит броней (%d активных)", r.MaxReservations)
+	}
+	return nil
+}
+
+func (r Rule) CheckLoans(active int) error {
+	if active >= r.MaxLoans {
+		return Deny(ReasonMaxLoans, "достигнут лимит выдач (%d на руках)", r.MaxLoans)
+	}
+	return nil
+}
+
+// Fine - штраф за выдачу со сроком due на момент now: полные дни просрочки
+// сверх льготного периода по дневной ставке, но не больше потолка.
+func (r Rule) Fine(due, now time.Time) models.Money {
+	start := due.AddDate(0, 0, r.GraceDays)
+	if !now.After(start) {
+		return 0
+	}
+	amount := models.Money(now.Sub(start)/(24*time.Hour)) * r.FinePerDay
+	if r.FineCap > 0 && amount > r.FineCap {
+		amount = r.FineCap
+	}
+	return amount
+}
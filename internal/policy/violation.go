@@ -0,0 +1,31 @@
+package policy
+
+import "fmt"
+
+// Коды причин отказа. Клиенты API опираются на них, а не на текст.
+const (
+	ReasonMaxReservations = "max_reservations"
+	ReasonMaxLoans        = "max_loans"
+	ReasonBadDays         = "bad_days"
+	ReasonMaxDuration     = "max_duration"
+	ReasonNotLoanable     = "not_loanable"
+	ReasonMaxRenewals     = "max_renewals"
+	ReasonWaitlist        = "waitlist"
+	ReasonNotActive       = "not_active"
+	ReasonUnknownPatron   = "unknown_patron"
+	ReasonPatronInactive  = "patron_inactive"
+)
+
+// Violation - отказ по правилам выдачи с кодом причины.
+type Violation struct {
+	Reason  string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+func Deny(reason, format string, args ...any) error {
+	return &Violation{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit - бюджет запросов: Burst запросов подряд, дальше RatePerMinute
+// запросов в минуту.
+type Limit struct {
+	RatePerMinute float64 `json:"rate_per_minute"`
+	Burst         int     `json:"burst"`
+}
+
+type Config struct {
+	Enabled bool             `json:"enabled"`
+	Default Limit            `json:"default"`
+	Groups  map[string]Limit `json:"groups"`
+}
+
+func Default() Config {
+	return Config{
+		Enabled: true,
+		Default: Limit{RatePerMinute: 120, Burst: 60},
+		Groups: map[string]Limit{
+			"auth":        {RatePerMinute: 10, Burst: 5},
+			AuthFailures:  {RatePerMinute: 10, Burst: 10},
+			"circulation": {RatePerMinute: 30, Burst: 10},
+			"search":      {RatePerMinute: 60, Burst: 20},
+		},
+	}
+}
+
+func (c Config) Validate() error {
+	check := func(name string, l Limit) error {
+		if l.RatePerMinute <= 0 || l.Burst <= 0 {
+			return fmt.Errorf("лимит %q: rate_per_minute и burst должны быть положительными", name)
+		}
+		return nil
+	}
+	if err := check("default", c.Default); err != nil {
+		return err
+	}
+	for name, l := range c.Groups {
+		if err := check(name, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter - token bucket на каждого клиента в каждой группе маршрутов.
+type Limiter struct {
+	mu        sync.Mutex
+	config    Config
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func New(c Config) *Limiter {
+	return &Limiter{config: c, buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (l *Limiter) limit(group string) Limit {
+	if limit, ok := l.config.Groups[group]; ok {
+		return limit
+	}
+	return l.config.Default
+}
+
+// Decision - результат проверки: пропущен ли запрос, сколько запросов
+// осталось и через сколько можно повторить.
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+func (l *Limiter) Allow(group, client string) Decision {
+	return l.take(group, client, 1)
+}
+
+// Check - как Allow, но не расходует бюджет.
+func (l *Limiter) Check(group, client string) Decision {
+	return l.take(group, client, 0)
+}
+
+func (l *Limiter) take(group, client string, cost float64) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit(group)
+	if !l.config.Enabled {
+		return Decision{Allowed: true, Limit: limit.Burst, Remaining: limit.Burst}
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	perSecond := limit.RatePerMinute / 60
+	key := group + "|" + client
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+		return Decision{Limit: limit.Burst, RetryAfter: wait}
+	}
+	b.tokens -= cost
+	return Decision{Allowed: true, Limit: limit.Burst, Remaining: int(b.tokens)}
+}
+
+// sweep раз в минуту удаляет корзины, которые успели наполниться:
+// они ничем не отличаются от новых.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		group, _, _ := cutGroup(key)
+		limit := l.limit(group)
+		if b.tokens+now.Sub(b.last).Seconds()*limit.RatePerMinute/60 >= float64(limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func cutGroup(key string) (string, string, bool) {
+	for i := 0; i < len(key); i++ {
+		if key[i] == '|' {
+			return key[:i], key[i+1:], true
+		}
+	}
+	return key, "", false
+}
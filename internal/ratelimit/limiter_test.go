@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter - лимитер с часами, которые двигает тест.
+func newTestLimiter(c Config) (*Limiter, *time.Time) {
+	l := New(c)
+	now := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.lastSweep = now
+	return l, &now
+}
+
+func testConfig() Config {
+	return Config{
+		Enabled: true,
+		Default: Limit{RatePerMinute: 60, Burst: 3},
+		Groups:  map[string]Limit{"search": {RatePerMinute: 6, Burst: 1}},
+	}
+}
+
+func TestBurstAndRefill(t *testing.T) {
+	l, now := newTestLimiter(testConfig())
+
+	for i := range 3 {
+		d := l.Allow("default", "ip:1")
+		if !d.Allowed || d.Limit != 3 || d.Remaining != 2-i {
+			t.Fatalf("запрос %d: %+v", i+1, d)
+		}
+	}
+	d := l.Allow("default", "ip:1")
+	if d.Allowed || d.RetryAfter != time.Second {
+		t.Fatalf("сверх burst: %+v", d)
+	}
+
+	// Токен в секунду; больше burst корзина не наполняется
+	*now = now.Add(1500 * time.Millisecond)
+	if d := l.Allow("default", "ip:1"); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("через 1.5 с: %+v", d)
+	}
+	if d := l.Allow("default", "ip:1"); d.Allowed || d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("через 1.5 с, второй запрос: %+v", d)
+	}
+	*now = now.Add(time.Hour)
+	if d := l.Allow("default", "ip:1"); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("через час: %+v", d)
+	}
+}
+
+func TestGroupsAndClientsSeparate(t *testing.T) {
+	l, _ := newTestLimiter(testConfig())
+
+	if d := l.Allow("search", "ip:1"); !d.Allowed || d.Limit != 1 {
+		t.Fatalf("поиск: %+v", d)
+	}
+	if d := l.Allow("search", "ip:1"); d.Allowed || d.RetryAfter != 10*time.Second {
+		t.Fatalf("поиск сверх лимита: %+v", d)
+	}
+	// Другая группа и другой клиент считаются отдельно
+	if d := l.Allow("default", "ip:1"); !d.Allowed {
+		t.Fatalf("другая группа: %+v", d)
+	}
+	if d := l.Allow("search", "ip:2"); !d.Allowed {
+		t.Fatalf("другой клиент: %+v", d)
+	}
+	if d := l.Allow("search", "user:ip:1"); !d.Allowed {
+		t.Fatalf("пользователь с похожим ключом: %+v", d)
+	}
+}
+
+func TestCheckDoesNotSpend(t *testing.T) {
+	l, _ := newTestLimiter(testConfig())
+
+	for range 5 {
+		if d := l.Check("search", "ip:1"); !d.Allowed || d.Remaining != 1 {
+			t.Fatalf("проверка: %+v", d)
+		}
+	}
+	l.Allow("search", "ip:1")
+	if d := l.Check("search", "ip:1"); d.Allowed {
+		t.Fatalf("проверка после исчерпания: %+v", d)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	c := testConfig()
+	c.Enabled = false
+	l, _ := newTestLimiter(c)
+
+	for range 10 {
+		if d := l.Allow("search", "ip:1"); !d.Allowed {
+			t.Fatalf("лимиты выключены, но запрос отклонён: %+v", d)
+		}
+	}
+}
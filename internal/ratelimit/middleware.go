@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"github.com/gin-gonic/gin"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Middleware ограничивает запросы. group относит запрос к группе маршрутов
+// со своим бюджетом, client - к клиенту (ключ, пользователь или IP).
+func (l *Limiter) Middleware(group, client func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		d := l.Allow(group(c), client(c))
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(d.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(d.Remaining))
+		if d.Allowed {
+			c.Next()
+			return
+		}
+		reject(c, d)
+	}
+}
+
+// AuthFailures - группа неудачных попыток входа по токену или ключу.
+const AuthFailures = "auth_failures"
+
+// Failures ограничивает неудачные запросы клиента: каждый ответ с одним
+// из statuses расходует бюджет группы, а пока бюджет исчерпан, запрос
+// отклоняется сразу. Подключается до проверки учётных данных, чтобы
+// подбор токенов и ключей упирался в лимит, а не в 401.
+func (l *Limiter) Failures(group string, client func(c *gin.Context) string, statuses ...int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := client(c)
+		if d := l.Check(group, key); !d.Allowed {
+			reject(c, d)
+			return
+		}
+		c.Next()
+		if slices.Contains(statuses, c.Writer.Status()) {
+			l.Allow(group, key)
+		}
+	}
+}
+
+func reject(c *gin.Context, d Decision) {
+	retry := int(math.Ceil(d.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retry))
+	c.AbortWithStatusJSON(429, gin.H{
+		"error":       "слишком много запросов, повторите позже",
+		"reason":      "rate_limited",
+		"retry_after": retry,
+	})
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// byHeader относит запрос к клиенту из заголовка X-Client.
+func byHeader(c *gin.Context) string {
+	return c.GetHeader("X-Client")
+}
+
+func get(router *gin.Engine, path, client string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("X-Client", client)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l, now := newTestLimiter(testConfig())
+	router := gin.New()
+	router.Use(l.Middleware(func(*gin.Context) string { return "search" }, byHeader))
+	router.GET("/search", func(c *gin.Context) { c.JSON(200, gin.H{}) })
+
+	w := get(router, "/search", "ip:1")
+	if w.Code != 200 || w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("первый запрос: %d %v", w.Code, w.Header())
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	w = get(router, "/search", "ip:1")
+	if w.Code != 429 || w.Header().Get("Retry-After") != "10" {
+		t.Fatalf("сверх лимита: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["reason"] != "rate_limited" || body["retry_after"] != float64(10) {
+		t.Fatalf("тело ответа 429: %v", body)
+	}
+
+	if w := get(router, "/search", "ip:2"); w.Code != 200 {
+		t.Fatalf("другой клиент: %d", w.Code)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := testConfig()
+	c.Groups[AuthFailures] = Limit{RatePerMinute: 1, Burst: 2}
+	l, now := newTestLimiter(c)
+
+	handled := 0
+	router := gin.New()
+	router.Use(l.Failures(AuthFailures, byHeader, 401))
+	router.GET("/denied", func(c *gin.Context) {
+		handled++
+		c.JSON(401, gin.H{})
+	})
+	router.GET("/forbidden", func(c *gin.Context) {
+		handled++
+		c.JSON(403, gin.H{})
+	})
+
+	// Другие ответы бюджет не расходуют
+	for range 5 {
+		if w := get(router, "/forbidden", "ip:1"); w.Code != 403 {
+			t.Fatalf("403 отклонён лимитом: %d", w.Code)
+		}
+	}
+	for i := range 2 {
+		if w := get(router, "/denied", "ip:1"); w.Code != 401 {
+			t.Fatalf("неудачная попытка %d: %d", i+1, w.Code)
+		}
+	}
+
+	// Бюджет исчерпан: запрос отклоняется до обработчика
+	handled = 0
+	for _, path := range []string{"/denied", "/forbidden"} {
+		if w := get(router, path, "ip:1"); w.Code != 429 || w.Header().Get("Retry-After") != "60" {
+			t.Fatalf("%s после исчерпания: %d, Retry-After %q", path, w.Code, w.Header().Get("Retry-After"))
+		}
+	}
+	if handled != 0 {
+		t.Fatalf("обработчик вызван %d раз после исчерпания бюджета", handled)
+	}
+	if w := get(router, "/denied", "ip:2"); w.Code != 401 {
+		t.Fatalf("другой клиент: %d", w.Code)
+	}
+
+	*now = now.Add(time.Minute)
+	if w := get(router, "/denied", "ip:1"); w.Code != 401 {
+		t.Fatalf("через минуту: %d", w.Code)
+	}
+}
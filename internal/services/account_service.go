@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"time"
+)
+
+const minPasswordLength = 8
+
+var (
+	ErrBadCredentials = errors.New("неверный email или пароль")
+	ErrAccountExists  = errors.New("учётная запись с таким email уже существует")
+)
+
+// dummyHash сравнивается с паролем, если учётной записи нет, чтобы время
+// ответа не выдавало, зарегистрирован ли email.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("library-app"), bcrypt.DefaultCost)
+
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("пароль должен быть не короче %d символов", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func accountByEmail(tx storage.Reader, email string) (*models.Account, error) {
+	accounts, err := tx.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		if a.Email == email {
+			return a, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+// createAccount заводит новую учётную запись с ролью role. Занятый
+// email - ErrAccountExists: чужую учётную запись так не перезаписать.
+func createAccount(tx storage.Tx, email, passwordHash, role string, now time.Time) (*models.Account, error) {
+	if _, err := accountByEmail(tx, email); err == nil {
+		return nil, ErrAccountExists
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return nil, err
+	}
+	account := &models.Account{
+		Email:        email,
+		PasswordHash: passwordHash,
+		Role:         role,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return account, tx.SaveAccount(account)
+}
+
+// setPassword меняет пароль существующей учётной записи. Проверить
+// право на смену (старый пароль) - забота вызывающего.
+func setPassword(tx storage.Tx, email, passwordHash string, now time.Time) error {
+	account, err := accountByEmail(tx, email)
+	if err != nil {
+		return err
+	}
+	account.PasswordHash = passwordHash
+	account.UpdatedAt = now
+	return tx.SaveAccount(account)
+}
+
+// Authenticate проверяет пароль и возвращает учётную запись.
+func (lib *Library) Authenticate(email, password string) (dto.AccountResponse, error) {
+	lib.mu.RLock()
+	account, err := accountByEmail(lib.repo, email)
+	lib.mu.RUnlock()
+
+	if err != nil {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return dto.AccountResponse{}, ErrBadCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return dto.AccountResponse{}, ErrBadCredentials
+	}
+	return accountResponse(account), nil
+}
+
+func (lib *Library) ChangePassword(email, oldPassword, newPassword string) error {
+	if _, err := lib.Authenticate(email, oldPassword); err != nil {
+		return err
+	}
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	return lib.repo.Update("ChangePassword", func(tx storage.Tx) error {
+		return setPassword(tx, email, hash, lib.now())
+	})
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"library-app/internal/auth"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"time"
+)
+
+// lastUsedInterval - как часто обновлять время последнего использования
+// ключа, чтобы не писать в хранилище на каждый запрос.
+const lastUsedInterval = time.Minute
+
+func apiKeyResponse(k *models.APIKey) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		CreatedBy:  k.CreatedBy,
+		CreatedAt:  k.CreatedAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+		Active:     k.IsActive(),
+	}
+}
+
+// CreateAPIKey создаёт ключ с правами scopes и возвращает его открытое
+// значение. Больше его получить нельзя.
+func (lib *Library) CreateAPIKey(name string, scopes []string, createdBy string) (string, dto.APIKeyResponse, error) {
+	if len(scopes) == 0 {
+		return "", dto.APIKeyResponse{}, fmt.Errorf("у ключа должно быть хотя бы одно право")
+	}
+	for _, scope := range scopes {
+		if !auth.ValidPermission(scope) {
+			return "", dto.APIKeyResponse{}, fmt.Errorf("неизвестное право %q", scope)
+		}
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	secret, prefix := auth.NewAPIKey()
+	key := &models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(secret),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: lib.now(),
+	}
+	err := lib.repo.Update("CreateAPIKey", func(tx storage.Tx) error {
+		return tx.SaveAPIKey(key)
+	})
+	if err != nil {
+		return "", dto.APIKeyResponse{}, err
+	}
+
+	fmt.Printf("Создан API-ключ %s (%s), права: %v\n", key.Prefix, key.Name, key.Scopes)
+	return secret, apiKeyResponse(key), nil
+}
+
+func (lib *Library) GetAPIKeys() []dto.APIKeyResponse {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	keys, _ := lib.repo.APIKeys()
+	result := []dto.APIKeyResponse{}
+	for _, k := range keys {
+		result = append(result, apiKeyResponse(k))
+	}
+	return result
+}
+
+func (lib *Library) RevokeAPIKey(id int) (dto.APIKeyResponse, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var key *models.APIKey
+	err := lib.repo.Update("RevokeAPIKey", func(tx storage.Tx) error {
+		var err error
+		key, err = tx.APIKey(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("API-ключ не найден")
+		}
+		if err != nil {
+			return err
+		}
+		if !key.IsActive() {
+			return fmt.Errorf("API-ключ уже отозван")
+		}
+
+		now := lib.now()
+		key.RevokedAt = &now
+		return tx.SaveAPIKey(key)
+	})
+	if err != nil {
+		return dto.APIKeyResponse{}, err
+	}
+
+	fmt.Printf("API-ключ %s отозван\n", key.Prefix)
+	return apiKeyResponse(key), nil
+}
+
+// VerifyAPIKey проверяет ключ и отмечает время его использования.
+func (lib *Library) VerifyAPIKey(secret string) (auth.Claims, error) {
+	prefix, ok := auth.APIKeyPrefix(secret)
+	if !ok {
+		return auth.Claims{}, auth.ErrInvalidAPIKey
+	}
+
+	lib.mu.RLock()
+	keys, err := lib.repo.APIKeys()
+	lib.mu.RUnlock()
+	if err != nil {
+		return auth.Claims{}, err
+	}
+
+	var key *models.APIKey
+	for _, k := range keys {
+		if k.Prefix == prefix {
+			key = k
+			break
+		}
+	}
+	if key == nil || !key.IsActive() ||
+		subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(auth.HashAPIKey(secret))) != 1 {
+		return auth.Claims{}, auth.ErrInvalidAPIKey
+	}
+
+	now := lib.now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedInterval {
+		lib.touchAPIKey(key.ID, now)
+	}
+
+	return auth.Claims{
+		Subject: "apikey:" + key.Prefix,
+		Scopes:  append([]string{}, key.Scopes...),
+	}, nil
+}
+
+func (lib *Library) touchAPIKey(id int, now time.Time) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	err := lib.repo.Update("TouchAPIKey", func(tx storage.Tx) error {
+		key, err := tx.APIKey(id)
+		if err != nil {
+			return err
+		}
+		key.LastUsedAt = &now
+		return tx.SaveAPIKey(key)
+	})
+	if err != nil {
+		fmt.Printf("Не удалось обновить время использования API-ключа #%d: %v\n", id, err)
+	}
+}
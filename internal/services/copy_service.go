@@ -0,0 +1,207 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"strings"
+)
+
+func bookCopies(tx storage.Reader, bookID int) ([]*models.Copy, error) {
+	all, err := tx.Copies()
+	if err != nil {
+		return nil, err
+	}
+	return filterCopies(all, bookID), nil
+}
+
+// syncAvailability пересчитывает IsAvailable книги по её экземплярам:
+// книга доступна, если доступен хотя бы один экземпляр.
+func syncAvailability(tx storage.Tx, bookID int) error {
+	book, err := findBookTx(tx, bookID)
+	if err != nil {
+		return err
+	}
+	copies, err := bookCopies(tx, bookID)
+	if err != nil {
+		return err
+	}
+
+	book.IsAvailable = false
+	for _, c := range copies {
+		if c.IsAvailable() {
+			book.IsAvailable = true
+			break
+		}
+	}
+	return tx.SaveBook(book)
+}
+
+// setCopyStatus меняет статус экземпляра и доступность его книги.
+func setCopyStatus(tx storage.Tx, c *models.Copy, status string) error {
+	c.Status = status
+	if err := tx.SaveCopy(c); err != nil {
+		return err
+	}
+	return syncAvailability(tx, c.BookID)
+}
+
+// pickCopy возвращает экземпляр copyID книги bookID или, если copyID не
+// задан, первый доступный экземпляр.
+func pickCopy(tx storage.Reader, bookID, copyID int) (*models.Copy, error) {
+	if copyID != 0 {
+		c, err := tx.Copy(copyID)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && c.BookID != bookID) {
+			return nil, fmt.Errorf("экземпляр #%d этой книги не найден", copyID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !c.IsAvailable() {
+			return nil, fmt.Errorf("экземпляр %s не доступен", c.Barcode)
+		}
+		return c, nil
+	}
+
+	c, err := firstAvailableCopy(tx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, ErrNoCopyAvailable
+	}
+	return c, nil
+}
+
+// firstAvailableCopy возвращает nil без ошибки, если свободных экземпляров нет.
+func firstAvailableCopy(tx storage.Reader, bookID int) (*models.Copy, error) {
+	copies, err := bookCopies(tx, bookID)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range copies {
+		if c.IsAvailable() {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (lib *Library) AddCopy(bookID int, barcode, branch, location, itemType string) (*models.Copy, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	barcode = strings.TrimSpace(barcode)
+	if itemType == "" {
+		itemType = models.DefaultItemType
+	}
+	c := &models.Copy{
+		BookID:   bookID,
+		Barcode:  barcode,
+		Branch:   branch,
+		Location: location,
+		ItemType: itemType,
+		Status:   models.CopyAvailable,
+	}
+
+	err := lib.update("AddCopy", func(tx storage.Tx, emit emitFunc) error {
+		if _, err := findBookTx(tx, bookID); err != nil {
+			return err
+		}
+
+		all, err := tx.Copies()
+		if err != nil {
+			return err
+		}
+		if c.Barcode == "" {
+			c.Barcode = models.DefaultBarcode(bookID, len(filterCopies(all, bookID))+1)
+		}
+		for _, existing := range all {
+			if existing.Barcode == c.Barcode {
+				return fmt.Errorf("экземпляр со штрихкодом %s уже существует", c.Barcode)
+			}
+		}
+
+		if err := tx.SaveCopy(c); err != nil {
+			return err
+		}
+		if err := syncAvailability(tx, bookID); err != nil {
+			return err
+		}
+
+		holds, err := lib.promoteWaitlist(tx, bookID, lib.now())
+		if err != nil {
+			return err
+		}
+		return emitHolds(emit, holds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Экземпляр мог сразу уйти первому в очереди
+	if saved, err := lib.repo.Copy(c.ID); err == nil {
+		c = saved
+	}
+
+	fmt.Printf("Добавлен экземпляр %s книги #%d\n", c.Barcode, bookID)
+	return c, nil
+}
+
+func filterCopies(copies []*models.Copy, bookID int) []*models.Copy {
+	var result []*models.Copy
+	for _, c := range copies {
+		if c.BookID == bookID {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+func (lib *Library) GetBookCopies(bookID int) ([]*models.Copy, error) {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	if _, err := findBookTx(lib.repo, bookID); err != nil {
+		return nil, err
+	}
+	copies, err := bookCopies(lib.repo, bookID)
+	if copies == nil {
+		copies = []*models.Copy{}
+	}
+	return copies, err
+}
+
+// GetBookDetails возвращает книгу с именем автора и числом экземпляров.
+func (lib *Library) GetBookDetails(id int) (*dto.BookResponse, error) {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	book, err := findBookTx(lib.repo, id)
+	if err != nil {
+		return nil, err
+	}
+	copies, err := bookCopies(lib.repo, id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &dto.BookResponse{
+		ID:          book.ID,
+		Title:       book.Title,
+		AuthorID:    book.AuthorID,
+		Year:        book.Year,
+		IsAvailable: book.IsAvailable,
+		TotalCopies: len(copies),
+	}
+	if author, err := lib.repo.Author(book.AuthorID); err == nil {
+		resp.AuthorName = author.Name
+	}
+	for _, c := range copies {
+		if c.IsAvailable() {
+			resp.AvailableCopies++
+		}
+	}
+	return resp, nil
+}
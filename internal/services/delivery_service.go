@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library-app/internal/email"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// RetryPolicy - повтор отправки писем: после неудачной попытки n
+// следующая будет через BaseDelay*2^(n-1) (не больше MaxDelay) со
+// случайным разбросом, после MaxAttempts попыток письмо уходит в
+// недоставленные.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 5, BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+}
+
+// Backoff - задержка перед попыткой attempt+1. Половина задержки
+// фиксирована, вторая половина случайна, чтобы повторы не шли разом.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// defaultClaimTimeout - срок, за который очередь в памяти успевает
+// разобрать письмо с запасом на таймауты SMTP.
+const defaultClaimTimeout = 10 * time.Minute
+
+var ErrNotDeadLetter = errors.New("письмо не в списке недоставленных")
+
+// dispatch забирает письмо в очередь и отдаёт его обработчикам.
+// notification - прочитанная раньше запись: письмо забирается, только
+// если в хранилище оно всё ещё в том же состоянии, иначе его уже забрал
+// другой проход или обработчик записал результат. Статус сохраняется до
+// постановки, чтобы результат отправки не затёрся. Если очередь занята,
+// письмо возвращается в "pending" и dispatch возвращает false.
+func (lib *Library) dispatch(notification *models.EmailNotification) bool {
+	var claimed *models.EmailNotification
+	err := lib.repo.Update("DispatchNotification", func(tx storage.Tx) error {
+		current, err := tx.Notification(notification.ID)
+		if err != nil {
+			return err
+		}
+		if current.Status != models.NotificationPending && current.Status != models.NotificationRetrying ||
+			current.Status != notification.Status || current.Attempts != notification.Attempts {
+			return nil
+		}
+		now := lib.now()
+		current.Status = models.NotificationQueued
+		current.QueuedAt = &now
+		claimed = current
+		return tx.SaveNotification(current)
+	})
+	if err != nil {
+		fmt.Printf("Не удалось обновить уведомление #%d: %v\n", notification.ID, err)
+		return false
+	}
+	if claimed == nil {
+		return true
+	}
+
+	queued := *claimed
+	if lib.Notifications.enqueue(&queued) {
+		return true
+	}
+
+	err = lib.repo.Update("DispatchNotification", func(tx storage.Tx) error {
+		claimed.Status = models.NotificationPending
+		claimed.QueuedAt = nil
+		return tx.SaveNotification(claimed)
+	})
+	if err != nil {
+		fmt.Printf("Не удалось обновить уведомление #%d: %v\n", notification.ID, err)
+	}
+	return false
+}
+
+// recordDelivery сохраняет результат попытки отправки: письмо
+// отправлено, будет повторено позже или стало недоставленным.
+func (lib *Library) recordDelivery(sent *models.EmailNotification, sendErr error) {
+	err := lib.repo.Update("RecordDelivery", func(tx storage.Tx) error {
+		notification, err := tx.Notification(sent.ID)
+		if err != nil {
+			return err
+		}
+
+		now := lib.now()
+		notification.Attempts++
+		notification.NextAttemptAt = nil
+		notification.QueuedAt = nil
+
+		switch {
+		case sendErr == nil:
+			notification.Status = models.NotificationSent
+			notification.SentAt = &now
+			notification.LastError = ""
+		case email.IsPermanent(sendErr) || notification.Attempts >= lib.retry.MaxAttempts:
+			notification.Status = models.NotificationDead
+			notification.LastError = sendErr.Error()
+			fmt.Printf("Письмо #%d для %s не доставлено после %d попыток: %v\n",
+				notification.ID, notification.To, notification.Attempts, sendErr)
+		default:
+			next := now.Add(lib.retry.Backoff(notification.Attempts))
+			notification.Status = models.NotificationRetrying
+			notification.NextAttemptAt = &next
+			notification.LastError = sendErr.Error()
+		}
+		return tx.SaveNotification(notification)
+	})
+	if err != nil {
+		fmt.Printf("Не удалось сохранить результат отправки письма #%d: %v\n", sent.ID, err)
+	}
+}
+
+// wakeOutbox сообщает диспетчерам, что в исходящих появились письма
+// или доставки вебхуков. Вызывается после фиксации транзакции, которая
+// их записала.
+func (lib *Library) wakeOutbox() {
+	for _, wake := range []chan struct{}{lib.outboxWake, lib.webhookWake} {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// DrainOutbox ставит в очередь новые письма из исходящих и письма,
+// которым подошёл срок повтора.
+func (lib *Library) DrainOutbox() {
+	all, err := lib.repo.Notifications()
+	if err != nil {
+		fmt.Printf("Ошибка чтения уведомлений: %v\n", err)
+		return
+	}
+
+	now := lib.now()
+	for _, notification := range all {
+		// У ожидающих писем срок бывает только из-за тихих часов читателя
+		waiting := notification.NextAttemptAt != nil && notification.NextAttemptAt.After(now)
+		due := notification.Status == models.NotificationPending && !waiting ||
+			notification.Status == models.NotificationRetrying && notification.NextAttemptAt != nil && !waiting
+		if !due {
+			continue
+		}
+		if !lib.dispatch(notification) {
+			// Очередь заполнена - остальные подождут следующего прохода
+			return
+		}
+	}
+}
+
+// StartOutboxDispatcher отправляет письма из исходящих: сразу после
+// новых записей и раз в interval для повторов, пока не отменён ctx.
+// Письма, застрявшие в очереди остановившейся реплики, отправляются заново.
+func (lib *Library) StartOutboxDispatcher(ctx context.Context, interval time.Duration) {
+	lib.recoverOutbox()
+
+	lib.loops.Add(1)
+	go func() {
+		defer lib.loops.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lib.DrainOutbox()
+		for {
+			select {
+			case <-ticker.C:
+				lib.recoverOutbox()
+				lib.DrainOutbox()
+			case <-lib.outboxWake:
+				lib.DrainOutbox()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// recoverOutbox возвращает в "pending" письма, забранные в очередь
+// дольше claimTimeout назад: их процесс остановился, не отправив их.
+// Свежие письма в очереди не трогаются - с общей базой их может
+// отправлять другая работающая реплика. Письмо, отправленное перед самым
+// падением, может уйти повторно - это лучше, чем потерять его.
+func (lib *Library) recoverOutbox() {
+	deadline := lib.now().Add(-lib.claimTimeout)
+	stale := func(notification *models.EmailNotification) bool {
+		return notification.Status == models.NotificationQueued &&
+			(notification.QueuedAt == nil || !notification.QueuedAt.After(deadline))
+	}
+
+	// Проверка вызывается периодически - без потерянных писем не пишем
+	all, err := lib.repo.Notifications()
+	if err != nil {
+		fmt.Printf("Ошибка чтения уведомлений: %v\n", err)
+		return
+	}
+	if !slices.ContainsFunc(all, stale) {
+		return
+	}
+
+	err = lib.repo.Update("RecoverOutbox", func(tx storage.Tx) error {
+		all, err := tx.Notifications()
+		if err != nil {
+			return err
+		}
+		for _, notification := range all {
+			if !stale(notification) {
+				continue
+			}
+			notification.Status = models.NotificationPending
+			notification.QueuedAt = nil
+			if err := tx.SaveNotification(notification); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Не удалось восстановить исходящие письма: %v\n", err)
+	}
+}
+
+// DeadLetters - письма, которые так и не удалось доставить.
+func (lib *Library) DeadLetters() []*models.EmailNotification {
+	all, err := lib.repo.Notifications()
+	if err != nil {
+		fmt.Printf("Ошибка чтения уведомлений: %v\n", err)
+		return nil
+	}
+
+	dead := []*models.EmailNotification{}
+	for _, notification := range all {
+		if notification.Status == models.NotificationDead {
+			dead = append(dead, notification)
+		}
+	}
+	return dead
+}
+
+func (lib *Library) FindNotification(id int) (*models.EmailNotification, error) {
+	notification, err := lib.repo.Notification(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("уведомление не найдено")
+	}
+	return notification, err
+}
+
+// RequeueNotification возвращает недоставленное письмо в очередь
+// с новым счётчиком попыток.
+func (lib *Library) RequeueNotification(id int) (*models.EmailNotification, error) {
+	var notification *models.EmailNotification
+	err := lib.repo.Update("RequeueNotification", func(tx storage.Tx) error {
+		var err error
+		notification, err = tx.Notification(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("уведомление не найдено")
+		}
+		if err != nil {
+			return err
+		}
+		if notification.Status != models.NotificationDead {
+			return ErrNotDeadLetter
+		}
+
+		notification.Status = models.NotificationPending
+		notification.Attempts = 0
+		notification.NextAttemptAt = nil
+		return tx.SaveNotification(notification)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lib.dispatch(notification)
+	return notification, nil
+}
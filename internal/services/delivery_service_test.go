@@ -0,0 +1,197 @@
+package services
+
+import (
+	"errors"
+	"library-app/internal/email"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"sync"
+	"testing"
+	"time"
+)
+
+func addNotification(t *testing.T, lib *Library) *models.EmailNotification {
+	t.Helper()
+	notification := &models.EmailNotification{
+		To:        "reader@example.com",
+		Subject:   "Книга выдана",
+		Message:   "Срок возврата - через две недели",
+		Status:    models.NotificationPending,
+		CreatedAt: lib.now(),
+	}
+	err := lib.repo.Update("AddNotification", func(tx storage.Tx) error {
+		return tx.SaveNotification(notification)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notification
+}
+
+// waitNotification ждёт, пока обработчик почты запишет результат отправки.
+func waitNotification(t *testing.T, lib *Library, id int, status string) *models.EmailNotification {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		notification, err := lib.FindNotification(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if notification.Status == status {
+			return notification
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("письмо #%d в статусе %s, ожидалось %s", id, notification.Status, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNotificationRetryDeadAndRequeue(t *testing.T) {
+	fake := email.NewFake()
+	fake.Err = errors.New("сервер недоступен")
+	lib, sim := newTestLibrary(t, fake)
+	notification := addNotification(t, lib)
+
+	// Временная ошибка - повтор по расписанию
+	lib.DrainOutbox()
+	n := waitNotification(t, lib, notification.ID, models.NotificationRetrying)
+	if n.Attempts != 1 || n.LastError != "сервер недоступен" {
+		t.Fatalf("после сбоя: попыток %d, ошибка %q", n.Attempts, n.LastError)
+	}
+	if n.NextAttemptAt == nil || !n.NextAttemptAt.After(sim.Now()) {
+		t.Fatalf("не назначен следующий повтор: %v", n.NextAttemptAt)
+	}
+	if _, err := lib.RequeueNotification(n.ID); !errors.Is(err, ErrNotDeadLetter) {
+		t.Fatalf("возврат в очередь повторяемого письма: %v", err)
+	}
+
+	// До срока повтора письмо не отправляется
+	lib.DrainOutbox()
+	if n := waitNotification(t, lib, notification.ID, models.NotificationRetrying); n.Attempts != 1 {
+		t.Fatalf("письмо повторено раньше срока: попыток %d", n.Attempts)
+	}
+
+	// Попытки исчерпаны - письмо недоставленное
+	if _, err := sim.Advance(2 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	lib.DrainOutbox()
+	n = waitNotification(t, lib, notification.ID, models.NotificationDead)
+	if n.Attempts != 2 || n.NextAttemptAt != nil {
+		t.Fatalf("недоставленное письмо: попыток %d, повтор %v", n.Attempts, n.NextAttemptAt)
+	}
+	if dead := lib.DeadLetters(); len(dead) != 1 || dead[0].ID != n.ID {
+		t.Fatalf("недоставленные письма: %v", dead)
+	}
+
+	// Сервер снова доступен: письмо возвращается в очередь и уходит
+	fake.Err = nil
+	if _, err := lib.RequeueNotification(n.ID); err != nil {
+		t.Fatal(err)
+	}
+	n = waitNotification(t, lib, notification.ID, models.NotificationSent)
+	if n.Attempts != 1 || n.SentAt == nil || n.LastError != "" {
+		t.Fatalf("после возврата в очередь: попыток %d, отправлено %v, ошибка %q", n.Attempts, n.SentAt, n.LastError)
+	}
+	if len(lib.DeadLetters()) != 0 {
+		t.Fatal("письмо осталось в недоставленных")
+	}
+	sent := fake.Sent()
+	if len(sent) != 1 || sent[0].To != "reader@example.com" || sent[0].Subject != "Книга выдана" {
+		t.Fatalf("отправлены письма %v", sent)
+	}
+}
+
+func TestNotificationPermanentError(t *testing.T) {
+	fake := email.NewFake()
+	fake.Err = email.Permanent(errors.New("550 адрес не существует"))
+	lib, _ := newTestLibrary(t, fake)
+	notification := addNotification(t, lib)
+
+	// Постоянная ошибка - без повторов, даже если попытки остались
+	lib.DrainOutbox()
+	n := waitNotification(t, lib, notification.ID, models.NotificationDead)
+	if n.Attempts != 1 || n.NextAttemptAt != nil {
+		t.Fatalf("после постоянной ошибки: попыток %d, повтор %v", n.Attempts, n.NextAttemptAt)
+	}
+}
+
+func TestRecoverOutboxLeavesFreshClaims(t *testing.T) {
+	lib, sim := newTestLibrary(t, email.NewFake())
+
+	// Письмо в очереди другой, работающей реплики и письмо реплики,
+	// которая остановилась час назад
+	fresh, stale := addNotification(t, lib), addNotification(t, lib)
+	now, hourAgo := sim.Now(), sim.Now().Add(-time.Hour)
+	fresh.QueuedAt, stale.QueuedAt = &now, &hourAgo
+	err := lib.repo.Update("Claim", func(tx storage.Tx) error {
+		for _, n := range []*models.EmailNotification{fresh, stale} {
+			n.Status = models.NotificationQueued
+			if err := tx.SaveNotification(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lib.recoverOutbox()
+
+	if n, _ := lib.FindNotification(fresh.ID); n.Status != models.NotificationQueued {
+		t.Fatalf("свежее письмо из очереди другой реплики: %s", n.Status)
+	}
+	if n, _ := lib.FindNotification(stale.ID); n.Status != models.NotificationPending || n.QueuedAt != nil {
+		t.Fatalf("письмо остановившейся реплики: %s, в очереди с %v", n.Status, n.QueuedAt)
+	}
+}
+
+func TestRequeueRacesDrainOutbox(t *testing.T) {
+	fake := email.NewFake()
+	lib, _ := newTestLibrary(t, fake)
+
+	const rounds, batch = 20, 5
+	for round := range rounds {
+		// Письма не доставлены из-за сбоя почты
+		fake.Err = email.Permanent(errors.New("550 адрес не существует"))
+		var ids []int
+		for range batch {
+			ids = append(ids, addNotification(t, lib).ID)
+		}
+		lib.DrainOutbox()
+		for _, id := range ids {
+			waitNotification(t, lib, id, models.NotificationDead)
+		}
+
+		// Сбой устранён; пока библиотекарь возвращает письма в очередь,
+		// диспетчер разбирает исходящие - каждое письмо уходит один раз
+		fake.Err = nil
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(3)
+			go func() {
+				defer wg.Done()
+				if _, err := lib.RequeueNotification(id); err != nil {
+					t.Error(err)
+				}
+			}()
+			for range 2 {
+				go func() {
+					defer wg.Done()
+					lib.DrainOutbox()
+				}()
+			}
+		}
+		wg.Wait()
+		lib.DrainOutbox()
+
+		for _, id := range ids {
+			waitNotification(t, lib, id, models.NotificationSent)
+		}
+		if sent := fake.Sent(); len(sent) != (round+1)*batch {
+			t.Fatalf("проход %d: отправлено %d писем, ожидалось %d", round, len(sent), (round+1)*batch)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"library-app/internal/events"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
+)
+
+// emitFunc публикует доменное событие внутри транзакции операции.
+type emitFunc func(events.Event) error
+
+// update - repo.Update для операций, которые публикуют доменные события.
+// Синхронные подписчики обрабатывают событие сразу, в транзакции
+// операции; асинхронные получают события только после её фиксации.
+func (lib *Library) update(op string, fn func(tx storage.Tx, emit emitFunc) error) error {
+	var published []events.Event
+	err := lib.repo.Update(op, func(tx storage.Tx) error {
+		published = nil
+		return fn(tx, func(e events.Event) error {
+			if err := lib.Events.Publish(tx, e); err != nil {
+				return err
+			}
+			published = append(published, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	lib.Events.Dispatch(published)
+	return nil
+}
+
+// emitHolds публикует брони, созданные для очереди ожидания.
+func emitHolds(emit emitFunc, holds []*models.Reservation) error {
+	for _, hold := range holds {
+		if err := emit(events.ReservationCreated{Reservation: hold, FromWaitlist: true}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscribe подключает к шине встроенных подписчиков: письма читателям,
+// вебхуки и журнал событий.
+func (lib *Library) subscribe(bus *events.Bus) {
+	lib.subscribeNotifications(bus)
+	lib.subscribeWebhooks(bus)
+
+	// Письма и доставки вебхуков уже записаны синхронными подписчиками,
+	// диспетчерам остаётся их забрать
+	bus.SubscribeAllAsync(func(events.Event) {
+		lib.wakeOutbox()
+	})
+	bus.SubscribeAllAsync(func(e events.Event) {
+		body, err := json.Marshal(e)
+		if err != nil {
+			body = []byte(err.Error())
+		}
+		fmt.Printf("Событие %s: %s\n", e.EventName(), body)
+	})
+}
+
+func (lib *Library) subscribeNotifications(bus *events.Bus) {
+	events.Subscribe(bus, func(tx storage.Tx, e events.BookCheckedOut) error {
+		return lib.notifyCheckout(tx, e.Loan.BookID, e.Loan.UserEmail, e.Loan.DueDate)
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.BookReturned) error {
+		return lib.notifyReturn(tx, e.Loan.BookID, e.Loan.UserEmail)
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.ReservationCreated) error {
+		// О своей брони читатель и так знает, пишем только очереди ожидания
+		if !e.FromWaitlist {
+			return nil
+		}
+		return lib.notifyHold(tx, e.Reservation)
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.ReservationExpired) error {
+		return lib.notifyExpired(tx, e.Reservation)
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.LoanDueSoon) error {
+		data, ok := bookData(tx, e.Loan.BookID)
+		if !ok {
+			return nil
+		}
+		data.Date = e.Loan.DueDate
+		return lib.notify(tx, templates.EventDueSoon, e.Loan.UserEmail, data)
+	})
+}
+
+func (lib *Library) subscribeWebhooks(bus *events.Bus) {
+	events.Subscribe(bus, func(tx storage.Tx, e events.ReservationCreated) error {
+		return lib.emitWebhook(tx, models.WebhookReservationCreated, reservationEvent(tx, e.Reservation))
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.ReservationCancelled) error {
+		return lib.emitWebhook(tx, models.WebhookReservationCancelled, reservationEvent(tx, e.Reservation))
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.ReservationExpired) error {
+		return lib.emitWebhook(tx, models.WebhookReservationExpired, reservationEvent(tx, e.Reservation))
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.BookCheckedOut) error {
+		return lib.emitWebhook(tx, models.WebhookBookCheckedOut, loanEvent(tx, e.Loan))
+	})
+	events.Subscribe(bus, func(tx storage.Tx, e events.BookReturned) error {
+		return lib.emitWebhook(tx, models.WebhookBookReturned, loanEvent(tx, e.Loan))
+	})
+}
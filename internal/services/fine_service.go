@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/storage"
+	"time"
+)
+
+func loanFine(tx storage.Reader, loanID int) (*models.Fine, error) {
+	fines, err := tx.Fines()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fines {
+		if f.LoanID == loanID {
+			return f, nil
+		}
+	}
+	return nil, nil
+}
+
+// accrueFine доначисляет штраф по выдаче до суммы на момент now
+// (ставка, потолок и льготный период берутся из правил выдачи).
+// Повторный вызов в тот же день ничего не меняет.
+func accrueFine(tx storage.Tx, rule policy.Rule, loan *models.Loan, now time.Time) error {
+	amount := rule.Fine(loan.DueDate, now)
+	if amount == 0 {
+		return nil
+	}
+
+	fine, err := loanFine(tx, loan.ID)
+	if err != nil {
+		return err
+	}
+	if fine == nil {
+		fine = &models.Fine{
+			LoanID:    loan.ID,
+			UserEmail: loan.UserEmail,
+			Status:    models.FineOpen,
+			CreatedAt: now,
+		}
+	}
+	if amount <= fine.Amount {
+		return nil
+	}
+
+	charge := amount - fine.Amount
+	fine.Amount = amount
+	fine.Status = models.FineOpen
+	fine.UpdatedAt = now
+	if err := tx.SaveFine(fine); err != nil {
+		return err
+	}
+	return tx.AddLedgerEntry(&models.LedgerEntry{
+		FineID:    fine.ID,
+		UserEmail: fine.UserEmail,
+		Type:      models.LedgerCharge,
+		Amount:    charge,
+		Note:      fmt.Sprintf("просрочка выдачи #%d", loan.ID),
+		CreatedAt: now,
+	})
+}
+
+// accrueOverdueFines доначисляет штрафы по всем просроченным выдачам.
+func (lib *Library) accrueOverdueFines(tx storage.Tx, now time.Time) error {
+	loans, err := tx.Loans()
+	if err != nil {
+		return err
+	}
+	for _, loan := range loans {
+		if loan.Status != models.LoanActive || !loan.IsOverdue(now) {
+			continue
+		}
+		if err := accrueFine(tx, lib.ruleForCopy(tx, loan.UserEmail, loan.CopyID), loan, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleFine проводит оплату или списание части штрафа.
+// Нулевая сумма означает весь остаток.
+func (lib *Library) settleFine(op string, fineID int, amount models.Money, entryType, note string) (*models.Fine, error) {
+	if amount < 0 {
+		return nil, fmt.Errorf("сумма не может быть отрицательной")
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var fine *models.Fine
+	err := lib.repo.Update(op, func(tx storage.Tx) error {
+		var err error
+		fine, err = tx.Fine(fineID)
+		if err != nil {
+			return fmt.Errorf("штраф не найден")
+		}
+
+		outstanding := fine.Outstanding()
+		if outstanding == 0 {
+			return fmt.Errorf("штраф уже погашен")
+		}
+		if amount == 0 {
+			amount = outstanding
+		}
+		if amount > outstanding {
+			return fmt.Errorf("сумма %s больше остатка %s", amount, outstanding)
+		}
+
+		now := lib.now()
+		if entryType == models.LedgerPayment {
+			fine.Paid += amount
+		} else {
+			fine.Waived += amount
+		}
+		if fine.Outstanding() == 0 {
+			fine.Status = models.FinePaid
+			if fine.Paid == 0 {
+				fine.Status = models.FineWaived
+			}
+		}
+		fine.UpdatedAt = now
+		if err := tx.SaveFine(fine); err != nil {
+			return err
+		}
+		return tx.AddLedgerEntry(&models.LedgerEntry{
+			FineID:    fine.ID,
+			UserEmail: fine.UserEmail,
+			Type:      entryType,
+			Amount:    amount,
+			Note:      note,
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fine, nil
+}
+
+func (lib *Library) PayFine(fineID int, amount models.Money) (*models.Fine, error) {
+	return lib.settleFine("PayFine", fineID, amount, models.LedgerPayment, "оплата")
+}
+
+func (lib *Library) WaiveFine(fineID int, amount models.Money, reason string) (*models.Fine, error) {
+	if reason == "" {
+		reason = "списание"
+	}
+	return lib.settleFine("WaiveFine", fineID, amount, models.LedgerWaiver, reason)
+}
+
+// PatronFines - штрафы читателя, его журнал расчётов и текущий долг.
+type PatronFines struct {
+	Fines   []*models.Fine        `json:"fines"`
+	Ledger  []*models.LedgerEntry `json:"ledger"`
+	Balance models.Money          `json:"balance"`
+}
+
+func (lib *Library) GetPatronFines(userEmail string) PatronFines {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	result := PatronFines{Fines: []*models.Fine{}, Ledger: []*models.LedgerEntry{}}
+
+	fines, _ := lib.repo.Fines()
+	for _, f := range fines {
+		if f.UserEmail == userEmail {
+			result.Fines = append(result.Fines, f)
+			result.Balance += f.Outstanding()
+		}
+	}
+
+	ledger, _ := lib.repo.Ledger()
+	for _, e := range ledger {
+		if e.UserEmail == userEmail {
+			result.Ledger = append(result.Ledger, e)
+		}
+	}
+	return result
+}
@@ -1,38 +1,132 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"library-app/internal/clock"
 	"library-app/internal/dto"
+	"library-app/internal/email"
+	"library-app/internal/events"
 	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
+	"library-app/internal/webhook"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Library struct {
-	mu                sync.RWMutex
-	Books             []*models.Book
-	Authors           []*models.Author
-	ReservationsSlice []*models.Reservation
-	NextIDBook        int
-	NextIDAuthor      int
-	ReservationID     int
-	Notifications     *NotificationService
-	Reservations      *ReservationService
+	mu            sync.RWMutex
+	repo          storage.Repository
+	Notifications *NotificationService
+	Reservations  *ReservationService
+	Policy        *policy.Engine
+	Clock         clock.Clock
+	Templates     *templates.Set
+	Webhooks      *webhook.Client
+	// Events - шина доменных событий: подписчики на неё получают
+	// изменения библиотеки, не трогая её методы
+	Events       *events.Bus
+	retry        RetryPolicy
+	webhookRetry RetryPolicy
+	// claimTimeout - через сколько письмо, забранное в очередь, считается
+	// потерянным остановившейся репликой
+	claimTimeout time.Duration
+	// UnsubscribeLink возвращает ссылку отписки email от писем о событии
+	// для подстановки в письма; nil - без ссылки
+	UnsubscribeLink func(email, event string) string
+	// outboxWake и webhookWake будят диспетчеры писем и вебхуков
+	// после записи новых исходящих
+	outboxWake  chan struct{}
+	webhookWake chan struct{}
+	// loops - периодические проверки (просроченные брони, исходящие письма)
+	loops sync.WaitGroup
 }
 
-func NewLibrary() *Library {
-	return &Library{
-		Books:         []*models.Book{},
-		Authors:       []*models.Author{},
-		NextIDBook:    1,
-		NextIDAuthor:  1,
-		ReservationID: 1,
-		Notifications: NewNotificationService(3),
-		Reservations:  NewReservationService(3),
+// Options - размеры пулов обработчиков и их очередей и способ
+// доставки писем.
+type Options struct {
+	Mailer             email.Mailer
+	EmailWorkers       int
+	EmailQueue         int
+	ReservationWorkers int
+	ReservationQueue   int
+	Retry              RetryPolicy
+	WebhookTimeout     time.Duration
+	WebhookRetry       RetryPolicy
+	EmailClaimTimeout  time.Duration
+}
+
+func NewLibrary(repo storage.Repository, opts Options) *Library {
+	lib := &Library{
+		repo:          repo,
+		Notifications: NewNotificationService(opts.EmailWorkers, opts.EmailQueue, opts.Mailer),
+		Reservations:  NewReservationService(opts.ReservationWorkers, opts.ReservationQueue),
+		Policy:        policy.NewEngine(policy.Default()),
+		Clock:         clock.Real{},
+		Templates:     templates.Default(),
+		Webhooks:      webhook.NewClient(opts.WebhookTimeout),
+		Events:        events.NewBus(),
+		retry:         opts.Retry,
+		webhookRetry:  opts.WebhookRetry,
+		claimTimeout:  opts.EmailClaimTimeout,
+		outboxWake:    make(chan struct{}, 1),
+		webhookWake:   make(chan struct{}, 1),
+	}
+	if lib.retry.MaxAttempts == 0 {
+		lib.retry = DefaultRetryPolicy()
+	}
+	if lib.webhookRetry.MaxAttempts == 0 {
+		lib.webhookRetry = DefaultRetryPolicy()
+	}
+	if lib.claimTimeout == 0 {
+		lib.claimTimeout = defaultClaimTimeout
+	}
+	lib.Notifications.report = lib.recordDelivery
+	lib.subscribe(lib.Events)
+	return lib
+}
+
+func (lib *Library) now() time.Time {
+	return lib.Clock.Now()
+}
+
+// Shutdown дожидается остановки периодических проверок (их ctx должен
+// быть уже отменён) и асинхронных подписчиков событий, затем закрывает
+// очереди и ждёт, пока обработчики их разберут. Всё это - не дольше, чем позволяет ctx.
+func (lib *Library) Shutdown(ctx context.Context) error {
+	if err := waitGroup(ctx, &lib.loops); err != nil {
+		return fmt.Errorf("периодические проверки не остановились: %w", err)
+	}
+	if err := lib.Events.Wait(ctx); err != nil {
+		return fmt.Errorf("подписчики событий не завершились: %w", err)
+	}
+
+	return errors.Join(
+		lib.Reservations.Shutdown(ctx),
+		lib.Notifications.EmailShutdown(ctx),
+	)
+}
+
+// waitGroup ждёт wg или отмены ctx.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
-func (lib *Library) AddAuthor(name, email, biography string) int {
+func (lib *Library) AddAuthor(name, email, biography string) (int, error) {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
@@ -42,76 +136,91 @@ func (lib *Library) AddAuthor(name, email, biography string) int {
 			Email: email,
 		},
 		Biography: biography,
-		AuthorID:  lib.NextIDAuthor,
 	}
-	lib.Authors = append(lib.Authors, author)
-	lib.NextIDAuthor++
+	err := lib.update("AddAuthor", func(tx storage.Tx, emit emitFunc) error {
+		if err := tx.SaveAuthor(author); err != nil {
+			return err
+		}
+		return emit(events.AuthorAdded{Author: author})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("не удалось сохранить автора: %w", err)
+	}
 
 	fmt.Printf("Добавлен автор: %s\n", author)
-	return author.AuthorID
+	return author.AuthorID, nil
 }
 
 func (lib *Library) FindAuthor(id int) *models.Author {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	for _, author := range lib.Authors {
-		if author.AuthorID == id {
-			return author
-		}
+	author, err := lib.repo.Author(id)
+	if err != nil {
+		return nil
 	}
-	return nil
+	return author
 }
 
 func (lib *Library) AddBook(title string, authorID int, year int) bool {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	// Проверяем существование автора
-	authorExists := false
-	for _, author := range lib.Authors {
-		if author.AuthorID == authorID {
-			authorExists = true
-			break
+	err := lib.update("AddBook", func(tx storage.Tx, emit emitFunc) error {
+		// Проверяем существование автора
+		if _, err := tx.Author(authorID); err != nil {
+			fmt.Printf("Автор с ID %d не найден\n", authorID)
+			return err
 		}
-	}
 
-	if !authorExists {
-		fmt.Printf("Автор с ID %d не найден\n", authorID)
-		return false
-	}
+		book := &models.Book{
+			Title:       title,
+			AuthorID:    authorID,
+			Year:        year,
+			IsAvailable: true,
+		}
+		if err := tx.SaveBook(book); err != nil {
+			return err
+		}
 
-	book := &models.Book{
-		ID:          lib.NextIDBook,
-		Title:       title,
-		AuthorID:    authorID,
-		Year:        year,
-		IsAvailable: true,
-	}
-	lib.Books = append(lib.Books, book)
-	lib.NextIDBook++
-	return true
+		err := tx.SaveCopy(&models.Copy{
+			BookID:   book.ID,
+			Barcode:  models.DefaultBarcode(book.ID, 1),
+			ItemType: models.DefaultItemType,
+			Status:   models.CopyAvailable,
+		})
+		if err != nil {
+			return err
+		}
+		return emit(events.BookAdded{Book: book})
+	})
+	return err == nil
 }
 
 func (lib *Library) FindBook(id int) *models.Book {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	for _, book := range lib.Books {
-		if book.ID == id {
-			return book
-		}
+	book, err := lib.repo.Book(id)
+	if err != nil {
+		return nil
 	}
-	return nil
+	return book
 }
 
 func (lib *Library) AdvancedSearchBooks(title string, year int) []*models.Book {
 	lib.mu.RLock()
 	defer lib.mu.RUnlock()
 
+	books, err := lib.repo.Books()
+	if err != nil {
+		fmt.Printf("Ошибка чтения книг: %v\n", err)
+		return nil
+	}
+
 	var results []*models.Book
 
-	for _, book := range lib.Books {
+	for _, book := range books {
 		match := true
 
 		// Поиск по названию (если передан)
@@ -144,105 +253,169 @@ func (lib *Library) UpdateBook(id int, req dto.UpdateBookRequest) error {
 		return fmt.Errorf("Не верный формат ввода года")
 	}
 
-	book := lib.findBookUnsafe(id)
-	if book == nil {
-		return fmt.Errorf("Книга не найдена")
-	}
+	return lib.update("UpdateBook", func(tx storage.Tx, emit emitFunc) error {
+		book, err := tx.Book(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("Книга не найдена")
+		}
+		if err != nil {
+			return err
+		}
 
-	if req.Title != nil {
-		book.Title = *req.Title
-	}
+		if req.Title != nil {
+			book.Title = *req.Title
+		}
 
-	if req.AuthorID != nil {
-		authorExists := false
-		for _, author := range lib.Authors {
-			if author.AuthorID == *req.AuthorID {
-				authorExists = true
-				break
+		if req.AuthorID != nil {
+			if _, err := tx.Author(*req.AuthorID); err != nil {
+				return fmt.Errorf("Автор с ID %d не найден", *req.AuthorID)
 			}
+			book.AuthorID = *req.AuthorID
 		}
 
-		if !authorExists {
-			return fmt.Errorf("Автор с ID %d не найден", *req.AuthorID)
+		if req.Year != nil {
+			book.Year = *req.Year
 		}
-		book.AuthorID = *req.AuthorID
-	}
 
-	if req.Year != nil {
-		book.Year = *req.Year
-	}
-
-	return nil
+		if err := tx.SaveBook(book); err != nil {
+			return err
+		}
+		return emit(events.BookUpdated{Book: book})
+	})
 }
 
 func (lib *Library) DeleteBook(id int) error {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	for i, book := range lib.Books {
-		if book.ID == id {
-			lib.Books = append(lib.Books[:i], lib.Books[i+1:]...)
-			return nil
+	return lib.update("DeleteBook", func(tx storage.Tx, emit emitFunc) error {
+		book, err := tx.Book(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("Книга не найдена")
+		}
+		if err != nil {
+			return err
 		}
-	}
 
-	return fmt.Errorf("Книга не найдена")
+		copies, err := bookCopies(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkBookUnused(tx, id, copies); err != nil {
+			return err
+		}
+		for _, c := range copies {
+			if err := tx.DeleteCopy(c.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.DeleteBook(id); err != nil {
+			return err
+		}
+		return emit(events.BookDeleted{Book: book})
+	})
 }
 
-func (lib *Library) findBookUnsafe(id int) *models.Book {
-	for _, book := range lib.Books {
-		if book.ID == id {
-			return book
+// checkBookUnused не даёт удалить книгу, пока на неё ссылаются выдачи,
+// брони или очередь ожидания: закрыть их после удаления было бы нельзя.
+func checkBookUnused(tx storage.Reader, id int, copies []*models.Copy) error {
+	for _, c := range copies {
+		if c.Status != models.CopyAvailable && c.Status != models.CopyLost {
+			return fmt.Errorf("%w: экземпляр %s не на полке (%s)", ErrBookInUse, c.Barcode, c.Status)
+		}
+	}
+
+	loans, err := tx.Loans()
+	if err != nil {
+		return err
+	}
+	for _, l := range loans {
+		if l.BookID == id && l.Status == models.LoanActive {
+			return fmt.Errorf("%w: книга выдана читателю %s", ErrBookInUse, l.UserEmail)
 		}
 	}
-	return nil
-}
 
-func (lib *Library) findAuthorUnsafe(id int) *models.Author {
-	for _, author := range lib.Authors {
-		if author.AuthorID == id {
-			return author
+	reservations, err := tx.Reservations()
+	if err != nil {
+		return err
+	}
+	for _, r := range reservations {
+		if r.BookID == id && r.Status == "active" {
+			return fmt.Errorf("%w: есть активная бронь #%d", ErrBookInUse, r.ID)
 		}
 	}
+
+	waiting, err := waitingEntries(tx, id)
+	if err != nil {
+		return err
+	}
+	if len(waiting) > 0 {
+		return fmt.Errorf("%w: в очереди ожидания %d читателей", ErrBookInUse, len(waiting))
+	}
 	return nil
 }
 
+// findBookTx переводит ErrNotFound хранилища в пользовательскую ошибку.
+func findBookTx(tx storage.Reader, id int) (*models.Book, error) {
+	book, err := tx.Book(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("книга не найдена")
+	}
+	return book, err
+}
+
 func (lib *Library) ListAllBooks() {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	books, _ := lib.repo.Books()
+
 	fmt.Println("\nВсе книги в библиотеке:")
-	if len(lib.Books) == 0 {
+	if len(books) == 0 {
 		fmt.Println("  Библиотека пуста")
 		return
 	}
 
-	lib.mu.Lock()
-	defer lib.mu.Unlock()
-
-	for _, book := range lib.Books {
+	for _, book := range books {
 		fmt.Printf("  %s\n", book)
 	}
 }
 
 func (lib *Library) ListAuthors() {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	authors, _ := lib.repo.Authors()
+
 	fmt.Println("\nАвторы в библиотеке:")
-	if len(lib.Authors) == 0 {
+	if len(authors) == 0 {
 		fmt.Println("  Нет авторов")
 		return
 	}
 
-	lib.mu.Lock()
-	defer lib.mu.Unlock()
-
-	for _, author := range lib.Authors {
+	for _, author := range authors {
 		fmt.Printf("  %s\n", author)
 	}
 }
 
+// IsEmpty сообщает, нет ли в хранилище ни одного автора и книги.
+func (lib *Library) IsEmpty() bool {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	books, _ := lib.repo.Books()
+	authors, _ := lib.repo.Authors()
+	return len(books) == 0 && len(authors) == 0
+}
+
 func (lib *Library) GetAllBooks() []models.Book {
 	lib.mu.RLock()
 	defer lib.mu.RUnlock()
 
-	books := make([]models.Book, len(lib.Books))
-	for i, book := range lib.Books {
+	all, _ := lib.repo.Books()
+	books := make([]models.Book, len(all))
+	for i, book := range all {
 		books[i] = *book
 	}
 	return books
@@ -252,8 +425,9 @@ func (lib *Library) GetAllAuthors() []models.Author {
 	lib.mu.RLock()
 	defer lib.mu.RUnlock()
 
-	authors := make([]models.Author, len(lib.Authors))
-	for i, author := range lib.Authors {
+	all, _ := lib.repo.Authors()
+	authors := make([]models.Author, len(all))
+	for i, author := range all {
 		authors[i] = *author
 	}
 	return authors
@@ -263,8 +437,10 @@ func (lib *Library) GetBooksByAuthor(authorID int) []models.Book {
 	lib.mu.RLock()
 	defer lib.mu.RUnlock()
 
+	books, _ := lib.repo.Books()
+
 	var authorBooks []models.Book
-	for _, book := range lib.Books {
+	for _, book := range books {
 		if book.AuthorID == authorID {
 			authorBooks = append(authorBooks, *book)
 		}
@@ -276,31 +452,13 @@ func (lib *Library) SearchBooks(query string) []models.Book {
 	lib.mu.RLock()
 	defer lib.mu.RUnlock()
 
+	books, _ := lib.repo.Books()
+
 	var results []models.Book
-	for _, book := range lib.Books {
+	for _, book := range books {
 		if strings.Contains(book.Title, query) {
 			results = append(results, *book)
 		}
 	}
 	return results
 }
-
-func (lib *Library) ReturnBook(bookID int, userEmail string) error {
-	lib.mu.Lock()
-	defer lib.mu.Unlock()
-
-	book := lib.findBookUnsafe(bookID)
-	if book == nil {
-		return fmt.Errorf("книга не найдена")
-	}
-
-	if book.IsAvailable {
-		return fmt.Errorf("книга уже доступна")
-	}
-
-	book.Return()
-
-	go lib.SendReturnEmail(bookID, userEmail)
-
-	return nil
-}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/events"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+)
+
+// CheckoutBook выдаёт книгу читателю. Если у него есть активная бронь
+// на эту книгу, выдаётся забронированный экземпляр, а бронь закрывается.
+// days = 0 - срок выдачи по правилам выдачи.
+func (lib *Library) CheckoutBook(bookID int, userEmail string, days int, copyID int) (*models.Loan, error) {
+	lib.mu.Lock()
+
+	now := lib.now()
+	loan := &models.Loan{
+		BookID:       bookID,
+		UserEmail:    userEmail,
+		CheckoutDate: now,
+		Status:       models.LoanActive,
+	}
+
+	err := lib.update("CheckoutBook", func(tx storage.Tx, emit emitFunc) error {
+		if _, err := activePatron(tx, userEmail, now); err != nil {
+			return err
+		}
+		if _, err := findBookTx(tx, bookID); err != nil {
+			return err
+		}
+
+		hold, err := userHold(tx, bookID, userEmail, copyID)
+		if err != nil {
+			return err
+		}
+
+		var c *models.Copy
+		if hold != nil {
+			c, err = tx.Copy(hold.CopyID)
+			if err != nil {
+				return err
+			}
+		} else {
+			c, err = pickCopy(tx, bookID, copyID)
+			if err != nil {
+				return err
+			}
+		}
+
+		rule := lib.rule(tx, userEmail, c)
+		period, err := rule.LoanPeriod(days)
+		if err != nil {
+			return err
+		}
+		active, err := activeLoans(tx, userEmail)
+		if err != nil {
+			return err
+		}
+		if err := rule.CheckLoans(active); err != nil {
+			return err
+		}
+
+		if hold != nil {
+			hold.Status = "completed"
+			if err := tx.SaveReservation(hold); err != nil {
+				return err
+			}
+			loan.ReservationID = hold.ID
+		}
+
+		loan.CopyID = c.ID
+		loan.DueDate = now.AddDate(0, 0, period)
+		if err := tx.SaveLoan(loan); err != nil {
+			return err
+		}
+		if err := setCopyStatus(tx, c, models.CopyOnLoan); err != nil {
+			return err
+		}
+		return emit(events.BookCheckedOut{Loan: loan})
+	})
+
+	lib.mu.Unlock()
+
+	if errors.Is(err, storage.ErrConflict) {
+		return nil, ErrNoCopyAvailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loan, nil
+}
+
+// userHold ищет активную бронь читателя на книгу (и экземпляр, если он задан).
+func userHold(tx storage.Reader, bookID int, userEmail string, copyID int) (*models.Reservation, error) {
+	reservations, err := tx.Reservations()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range reservations {
+		if r.BookID == bookID && r.UserEmail == userEmail && r.Status == "active" &&
+			(copyID == 0 || r.CopyID == copyID) {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// ReturnBook закрывает выдачу книги читателю. Если у него на руках
+// несколько экземпляров этой книги, нужно указать copyID.
+func (lib *Library) ReturnBook(bookID int, userEmail string, copyID int) error {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	// Книгу не проверяем: вернуть выданное можно, даже если её запись
+	// уже недоступна
+	return lib.update("ReturnBook", func(tx storage.Tx, emit emitFunc) error {
+		loans, err := tx.Loans()
+		if err != nil {
+			return err
+		}
+
+		var loan *models.Loan
+		for _, l := range loans {
+			if l.BookID != bookID || l.Status != models.LoanActive || (copyID != 0 && l.CopyID != copyID) {
+				continue
+			}
+			if l.UserEmail != userEmail {
+				if copyID != 0 {
+					return fmt.Errorf("экземпляр выдан другому читателю")
+				}
+				continue
+			}
+			loan = l
+			break
+		}
+		if loan == nil {
+			return fmt.Errorf("у пользователя нет выданного экземпляра этой книги")
+		}
+
+		now := lib.now()
+		if err := accrueFine(tx, lib.ruleForCopy(tx, userEmail, loan.CopyID), loan, now); err != nil {
+			return err
+		}
+		loan.ReturnDate = &now
+		loan.Status = models.LoanReturned
+		if err := tx.SaveLoan(loan); err != nil {
+			return err
+		}
+
+		if err := emit(events.BookReturned{Loan: loan}); err != nil {
+			return err
+		}
+
+		c, err := tx.Copy(loan.CopyID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		holds, err := lib.freeCopy(tx, c, now)
+		if err != nil {
+			return err
+		}
+		return emitHolds(emit, holds)
+	})
+}
+
+func (lib *Library) GetUserLoans(userEmail string) []*models.Loan {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	loans, _ := lib.repo.Loans()
+
+	result := []*models.Loan{}
+	for _, loan := range loans {
+		if loan.UserEmail == userEmail {
+			result = append(result, loan)
+		}
+	}
+	return result
+}
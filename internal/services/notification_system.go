@@ -1,21 +1,36 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"library-app/internal/email"
+	"library-app/internal/events"
 	"library-app/internal/models"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
 	"sync"
 	"time"
 )
 
+// dueReminderWindow - за сколько до срока возврата читателю приходит
+// напоминание.
+const dueReminderWindow = 48 * time.Hour
+
 type NotificationService struct {
 	EmailQueue chan *models.EmailNotification
+	Mailer     email.Mailer
 	Workers    int
 	WG         sync.WaitGroup
+	closeMu    sync.RWMutex
+	closed     bool
+	// report сохраняет результат отправки (см. Library.recordDelivery)
+	report func(notification *models.EmailNotification, err error)
 }
 
-func NewNotificationService(workers int) *NotificationService {
+func NewNotificationService(workers, queueSize int, mailer email.Mailer) *NotificationService {
 	ns := &NotificationService{
-		EmailQueue: make(chan *models.EmailNotification, 100),
+		EmailQueue: make(chan *models.EmailNotification, queueSize),
+		Mailer:     mailer,
 		Workers:    workers,
 	}
 
@@ -30,63 +45,186 @@ func NewNotificationService(workers int) *NotificationService {
 func (ns *NotificationService) emailWorker(id int) {
 	defer ns.WG.Done()
 
-	for email := range ns.EmailQueue {
-		fmt.Printf("Почтовый работник #%d отправляет email: %s\n", id, email.Subject)
-
-		time.Sleep(100 * time.Millisecond)
-		fmt.Printf("Почтовый работник #%d отправил email: %s\n", id, email.To)
+	for notification := range ns.EmailQueue {
+		fmt.Printf("Почтовый работник #%d отправляет email: %s\n", id, notification.Subject)
+
+		err := ns.Mailer.Send(context.Background(), email.Message{
+			To:      notification.To,
+			Subject: notification.Subject,
+			Text:    notification.Message,
+			HTML:    notification.HTML,
+		})
+		if err != nil {
+			fmt.Printf("Почтовый работник #%d не смог отправить email %s: %v\n", id, notification.To, err)
+		} else {
+			fmt.Printf("Почтовый работник #%d отправил email: %s\n", id, notification.To)
+		}
+		if ns.report != nil {
+			ns.report(notification, err)
+		}
 	}
 	fmt.Printf("Почтовый работник #%d остановлен\n", id)
 }
 
-func (ns *NotificationService) EmailShutdown() {
-	close(ns.EmailQueue)
-	ns.WG.Wait()
+// enqueue ставит письмо в очередь. После EmailShutdown очередь закрыта
+// и письмо не принимается.
+func (ns *NotificationService) enqueue(notification *models.EmailNotification) bool {
+	ns.closeMu.RLock()
+	defer ns.closeMu.RUnlock()
+
+	if ns.closed {
+		return false
+	}
+	select {
+	case ns.EmailQueue <- notification:
+		return true
+	default:
+		return false
+	}
+}
+
+// EmailShutdown закрывает очередь и ждёт, пока обработчики отправят
+// уже принятые письма, но не дольше, чем позволяет ctx.
+func (ns *NotificationService) EmailShutdown(ctx context.Context) error {
+	ns.closeMu.Lock()
+	if !ns.closed {
+		ns.closed = true
+		close(ns.EmailQueue)
+	}
+	ns.closeMu.Unlock()
+
+	if err := waitGroup(ctx, &ns.WG); err != nil {
+		return fmt.Errorf("не отправлено писем: %d: %w", len(ns.EmailQueue), err)
+	}
 	fmt.Printf("Завершение системы уведомлений успешно завершено\n")
+	return nil
 }
 
-func (lib *Library) SendEmail(bookID int, userEmail string) {
-	book := lib.FindBook(bookID)
-	if book == nil {
-		return
+// notifyCheckout сообщает о выдаче книги и сроке возврата due.
+func (lib *Library) notifyCheckout(tx storage.Tx, bookID int, userEmail string, due time.Time) error {
+	data, ok := bookData(tx, bookID)
+	if !ok {
+		return nil
 	}
+	data.Date = due
+	return lib.notify(tx, templates.EventCheckout, userEmail, data)
+}
 
-	author := lib.FindAuthor(book.AuthorID)
-	authorName := "unknown"
-	if author != nil {
-		authorName = author.Name
+func (lib *Library) notifyReturn(tx storage.Tx, bookID int, userEmail string) error {
+	data, ok := bookData(tx, bookID)
+	if !ok {
+		return nil
 	}
+	return lib.notify(tx, templates.EventReturn, userEmail, data)
+}
 
-	notification := &models.EmailNotification{
-		To:      userEmail,
-		Subject: "Книга взята",
-		Message: fmt.Sprintf("Книга \"%s\" (автор: %s) была получена", book.Title, authorName),
+// notifyHold сообщает читателю из очереди, что для него отложен экземпляр.
+func (lib *Library) notifyHold(tx storage.Tx, hold *models.Reservation) error {
+	data, ok := bookData(tx, hold.BookID)
+	if !ok {
+		return nil
 	}
+	data.Date = hold.EndDate
+	return lib.notify(tx, templates.EventHoldAvailable, hold.UserEmail, data)
+}
 
-	select {
-	case lib.Notifications.EmailQueue <- notification:
-		fmt.Printf("Уведомление поставлено в очередь\n")
-	default:
-		fmt.Printf("Очередь уведомлений переполнена\n")
+// remindDueSoon публикует LoanDueSoon для выдач, срок возврата которых
+// наступит в ближайшие dueReminderWindow. Напоминание по выдаче одно,
+// после продления - снова.
+func remindDueSoon(tx storage.Tx, emit emitFunc, now time.Time) error {
+	loans, err := tx.Loans()
+	if err != nil {
+		return err
+	}
+	for _, loan := range loans {
+		if loan.Status != models.LoanActive || loan.RemindedAt != nil ||
+			loan.IsOverdue(now) || loan.DueDate.Sub(now) > dueReminderWindow {
+			continue
+		}
+
+		loan.RemindedAt = &now
+		if err := tx.SaveLoan(loan); err != nil {
+			return err
+		}
+		if err := emit(events.LoanDueSoon{Loan: loan}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (lib *Library) notifyExpired(tx storage.Tx, reservation *models.Reservation) error {
+	// Книгу могли удалить, письмо о брони всё равно нужно
+	data, _ := bookData(tx, reservation.BookID)
+	data.ReservationID = reservation.ID
+	return lib.notify(tx, templates.EventReservationExpired, reservation.UserEmail, data)
+}
+
+func bookData(tx storage.Reader, bookID int) (templates.Data, bool) {
+	book, err := tx.Book(bookID)
+	if err != nil {
+		return templates.Data{}, false
+	}
+
+	data := templates.Data{Book: book.Title}
+	if author, err := tx.Author(book.AuthorID); err == nil {
+		data.Author = author.Name
 	}
+	return data, true
 }
 
-func (lib *Library) SendReturnEmail(bookID int, userEmail string) {
-	book := lib.FindBook(bookID)
-	if book == nil {
-		return
+// notify собирает письмо о событии по шаблону на языке читателя и
+// записывает его в исходящие в той же транзакции, что и само событие:
+// откат операции отменяет и письмо, а записанное письмо переживёт
+// перезапуск. Отправляет его диспетчер исходящих после фиксации.
+//
+// Письма, отключённые читателем, не записываются, а письма в его тихие
+// часы ждут в исходящих их окончания.
+func (lib *Library) notify(tx storage.Tx, event, userEmail string, data templates.Data) error {
+	lang := templates.DefaultLang
+	prefs := models.NotificationPreferences{Channel: models.ChannelEmail}
+	if patron, err := patronByEmail(tx, userEmail); err == nil {
+		data.Name = patron.Name
+		if patron.Language != "" {
+			lang = patron.Language
+		}
+		prefs = patron.Notifications
+		if lib.UnsubscribeLink != nil {
+			data.UnsubscribeURL = lib.UnsubscribeLink(userEmail, event)
+		}
+	}
+	if !prefs.Wants(event) {
+		fmt.Printf("Письмо %s для %s отключено в настройках читателя\n", event, userEmail)
+		return nil
+	}
+
+	msg, err := lib.Templates.Render(event, lang, data)
+	if err != nil {
+		// Сломанный шаблон не должен отменять выдачу или возврат
+		fmt.Printf("Не удалось подготовить письмо %s: %v\n", event, err)
+		return nil
 	}
 
+	now := lib.now()
 	notification := &models.EmailNotification{
-		To:      userEmail,
-		Subject: "Книга возвращена",
-		Message: fmt.Sprintf("Книга %s возвращена в библиотеку", book.Title),
+		To:        userEmail,
+		Subject:   msg.Subject,
+		Message:   msg.Text,
+		HTML:      msg.HTML,
+		Status:    models.NotificationPending,
+		CreatedAt: now,
 	}
+	if until, quiet := prefs.QuietUntil(now); quiet {
+		notification.NextAttemptAt = &until
+	}
+	return tx.SaveNotification(notification)
+}
 
-	select {
-	case lib.Notifications.EmailQueue <- notification:
-		fmt.Printf("Уведомление о возвращении поставлено в очередь\n")
-	default:
-		fmt.Printf("Очередь уведомлений переполнена\n")
+// PreviewNotification показывает письмо о событии на языке lang
+// с примерными данными.
+func (lib *Library) PreviewNotification(event, lang string) (templates.Message, error) {
+	if !templates.ValidLanguage(lang) {
+		return templates.Message{}, fmt.Errorf("неизвестный язык %q", lang)
 	}
+	return lib.Templates.Render(event, lang, templates.Sample(lib.now()))
 }
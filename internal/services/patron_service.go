@@ -0,0 +1,223 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
+	"time"
+)
+
+// Срок действия читательского билета
+const membershipYears = 1
+
+var (
+	ErrUnknownPatron error = &policy.Violation{
+		Reason:  policy.ReasonUnknownPatron,
+		Message: "читатель не зарегистрирован",
+	}
+	ErrPatronInactive error = &policy.Violation{
+		Reason:  policy.ReasonPatronInactive,
+		Message: "читательский билет заблокирован или просрочен",
+	}
+	ErrNotOwner = errors.New("бронь или выдача принадлежит другому читателю")
+)
+
+// checkOwner проверяет, что запись принадлежит читателю userEmail.
+// Пустой userEmail - действие сотрудника, проверка не нужна.
+func checkOwner(ownerEmail, userEmail string) error {
+	if userEmail != "" && ownerEmail != userEmail {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func patronByEmail(tx storage.Reader, email string) (*models.Patron, error) {
+	patrons, err := tx.Patrons()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range patrons {
+		if p.Email == email {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownPatron
+}
+
+// activePatron проверяет, что читатель зарегистрирован и может брать книги.
+func activePatron(tx storage.Reader, email string, now time.Time) (*models.Patron, error) {
+	patron, err := patronByEmail(tx, email)
+	if err != nil {
+		return nil, err
+	}
+	if !patron.IsActive(now) {
+		return nil, ErrPatronInactive
+	}
+	return patron, nil
+}
+
+func (lib *Library) RegisterPatron(req dto.CreatePatronRequest) (*models.Patron, error) {
+	passwordHash, err := hashPassword(req.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	if req.Language == "" {
+		req.Language = templates.DefaultLang
+	}
+
+	// Категорию меняют только сотрудники через UpdatePatron
+	now := lib.now()
+	patron := &models.Patron{
+		Person:   models.Person{Name: req.Name, Email: req.Email},
+		Phone:    req.Phone,
+		Address:  req.Address,
+		Category: models.DefaultPatronCategory,
+		Language: req.Language,
+		Notifications: models.NotificationPreferences{
+			Muted:   []string{},
+			Channel: models.ChannelEmail,
+		},
+		Status:       models.PatronActive,
+		RegisteredAt: now,
+		ExpiresAt:    now.AddDate(membershipYears, 0, 0),
+	}
+
+	err = lib.repo.Update("RegisterPatron", func(tx storage.Tx) error {
+		if _, err := patronByEmail(tx, req.Email); err == nil {
+			return fmt.Errorf("читатель с email %s уже зарегистрирован", req.Email)
+		} else if !errors.Is(err, ErrUnknownPatron) {
+			return err
+		}
+
+		if err := tx.SavePatron(patron); err != nil {
+			return err
+		}
+		patron.CardNumber = models.CardNumber(patron.ID)
+		if err := tx.SavePatron(patron); err != nil {
+			return err
+		}
+		_, err := createAccount(tx, patron.Email, passwordHash, models.RolePatron, now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Зарегистрирован читатель %s, билет %s\n", patron.Person, patron.CardNumber)
+	return patron, nil
+}
+
+func (lib *Library) FindPatron(email string) (*models.Patron, error) {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	return patronByEmail(lib.repo, email)
+}
+
+func (lib *Library) GetAllPatrons() []*models.Patron {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	patrons, _ := lib.repo.Patrons()
+	return patrons
+}
+
+func (lib *Library) FindPatronByCard(cardNumber string) (*models.Patron, error) {
+	for _, p := range lib.GetAllPatrons() {
+		if p.CardNumber == cardNumber {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownPatron
+}
+
+func (lib *Library) UpdatePatron(email string, req dto.UpdatePatronRequest) (*models.Patron, error) {
+	if req.Name == nil && req.Phone == nil && req.Address == nil && req.Status == nil &&
+		req.Category == nil && req.Language == nil && !req.Renew {
+		return nil, fmt.Errorf("Не указаны поля для обновления")
+	}
+	if req.Status != nil && *req.Status != models.PatronActive && *req.Status != models.PatronSuspended {
+		return nil, fmt.Errorf("статус может быть только %q или %q", models.PatronActive, models.PatronSuspended)
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var patron *models.Patron
+	err := lib.repo.Update("UpdatePatron", func(tx storage.Tx) error {
+		var err error
+		patron, err = patronByEmail(tx, email)
+		if err != nil {
+			return err
+		}
+
+		if req.Name != nil {
+			patron.Name = *req.Name
+		}
+		if req.Phone != nil {
+			patron.Phone = *req.Phone
+		}
+		if req.Address != nil {
+			patron.Address = *req.Address
+		}
+		if req.Status != nil {
+			patron.Status = *req.Status
+		}
+		if req.Category != nil {
+			patron.Category = *req.Category
+		}
+		if req.Language != nil {
+			patron.Language = *req.Language
+		}
+		if req.Renew {
+			now := lib.now()
+			from := patron.ExpiresAt
+			if from.Before(now) {
+				from = now
+			}
+			patron.ExpiresAt = from.AddDate(membershipYears, 0, 0)
+			if patron.Status == models.PatronExpired {
+				patron.Status = models.PatronActive
+			}
+		}
+		return tx.SavePatron(patron)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patron, nil
+}
+
+// DeactivatePatron блокирует билет читателя. История броней и выдач сохраняется.
+func (lib *Library) DeactivatePatron(email string) error {
+	status := models.PatronSuspended
+	_, err := lib.UpdatePatron(email, dto.UpdatePatronRequest{Status: &status})
+	return err
+}
+
+// expireMemberships переводит в "expired" билеты с истёкшим сроком действия.
+func expireMemberships(tx storage.Tx, now time.Time) error {
+	patrons, err := tx.Patrons()
+	if err != nil {
+		return err
+	}
+	for _, p := range patrons {
+		if p.Status != models.PatronActive || now.Before(p.ExpiresAt) {
+			continue
+		}
+		fmt.Printf("Истёк срок билета %s читателя %s\n", p.CardNumber, p.Email)
+		p.Status = models.PatronExpired
+		if err := tx.SavePatron(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/storage"
+)
+
+// rule выбирает правила выдачи для читателя и экземпляра. Незарегистрированные
+// читатели (старые записи) и неизвестные экземпляры получают правила по умолчанию.
+func (lib *Library) rule(tx storage.Reader, userEmail string, c *models.Copy) policy.Rule {
+	category := ""
+	if patron, err := patronByEmail(tx, userEmail); err == nil {
+		category = patron.Category
+	}
+	itemType := ""
+	if c != nil {
+		itemType = c.ItemType
+	}
+	return lib.Policy.Rule(category, itemType)
+}
+
+func (lib *Library) ruleForCopy(tx storage.Reader, userEmail string, copyID int) policy.Rule {
+	c, err := tx.Copy(copyID)
+	if err != nil {
+		c = nil
+	}
+	return lib.rule(tx, userEmail, c)
+}
+
+func activeLoans(tx storage.Reader, userEmail string) (int, error) {
+	loans, err := tx.Loans()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, loan := range loans {
+		if loan.UserEmail == userEmail && loan.Status == models.LoanActive {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"library-app/internal/templates"
+	"slices"
+)
+
+func preferencesResponse(patron *models.Patron) *dto.NotificationPreferencesResponse {
+	prefs := patron.Notifications
+	events := make(map[string]bool, len(templates.Events))
+	for _, event := range templates.Events {
+		events[event] = !slices.Contains(prefs.Muted, event)
+	}
+	return &dto.NotificationPreferencesResponse{
+		Events:     events,
+		Channel:    prefs.Channel,
+		Language:   patron.Language,
+		QuietStart: prefs.QuietStart,
+		QuietEnd:   prefs.QuietEnd,
+	}
+}
+
+func (lib *Library) NotificationPreferences(email string) (*dto.NotificationPreferencesResponse, error) {
+	patron, err := lib.FindPatron(email)
+	if err != nil {
+		return nil, err
+	}
+	return preferencesResponse(patron), nil
+}
+
+func (lib *Library) UpdateNotificationPreferences(email string, req dto.UpdateNotificationPreferencesRequest) (*dto.NotificationPreferencesResponse, error) {
+	for event := range req.Events {
+		if !templates.ValidEvent(event) {
+			return nil, fmt.Errorf("неизвестное событие %q", event)
+		}
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var patron *models.Patron
+	err := lib.repo.Update("UpdateNotificationPreferences", func(tx storage.Tx) error {
+		var err error
+		patron, err = patronByEmail(tx, email)
+		if err != nil {
+			return err
+		}
+
+		prefs := &patron.Notifications
+		for event, enabled := range req.Events {
+			prefs.Muted = setMuted(prefs.Muted, event, !enabled)
+		}
+		if req.Channel != nil {
+			prefs.Channel = *req.Channel
+		}
+		if req.Language != nil {
+			patron.Language = *req.Language
+		}
+		if req.QuietStart != nil {
+			prefs.QuietStart = *req.QuietStart
+		}
+		if req.QuietEnd != nil {
+			prefs.QuietEnd = *req.QuietEnd
+		}
+		if err := validateQuietHours(*prefs); err != nil {
+			return err
+		}
+		return tx.SavePatron(patron)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return preferencesResponse(patron), nil
+}
+
+// Unsubscribe отключает письма о событии event (пустой event - все
+// письма) по ссылке из письма.
+func (lib *Library) Unsubscribe(email, event string) error {
+	if event != "" && !templates.ValidEvent(event) {
+		return fmt.Errorf("неизвестное событие %q", event)
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	err := lib.repo.Update("Unsubscribe", func(tx storage.Tx) error {
+		patron, err := patronByEmail(tx, email)
+		if err != nil {
+			return err
+		}
+		if event == "" {
+			patron.Notifications.Channel = models.ChannelNone
+		} else {
+			patron.Notifications.Muted = setMuted(patron.Notifications.Muted, event, true)
+		}
+		return tx.SavePatron(patron)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Читатель %s отписался от писем %q\n", email, event)
+	return nil
+}
+
+// setMuted возвращает новый список отключённых событий: срез общий
+// с хранилищем в памяти, менять его на месте нельзя.
+func setMuted(muted []string, event string, mute bool) []string {
+	out := make([]string, 0, len(muted)+1)
+	for _, m := range muted {
+		if m != event {
+			out = append(out, m)
+		}
+	}
+	if mute {
+		out = append(out, event)
+	}
+	return out
+}
+
+func validateQuietHours(prefs models.NotificationPreferences) error {
+	if (prefs.QuietStart == "") != (prefs.QuietEnd == "") {
+		return fmt.Errorf("тихие часы задаются началом и концом вместе")
+	}
+	if prefs.QuietStart == "" {
+		return nil
+	}
+	start, err := models.ParseClock(prefs.QuietStart)
+	if err != nil {
+		return err
+	}
+	end, err := models.ParseClock(prefs.QuietEnd)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("начало и конец тихих часов совпадают")
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/models"
+	"library-app/internal/policy"
+	"library-app/internal/storage"
+	"time"
+)
+
+// checkRenewal проверяет общие правила продления и возвращает новую дату
+// окончания. maxDays - предельный общий срок из правила выдачи.
+func checkRenewal(tx storage.Reader, rule policy.Rule, bookID int, start, end time.Time, renewals, days, maxDays int) (time.Time, error) {
+	if days <= 0 {
+		return time.Time{}, policy.Deny(policy.ReasonBadDays, "срок продления должен быть положительным")
+	}
+	if renewals >= rule.MaxRenewals {
+		return time.Time{}, policy.Deny(policy.ReasonMaxRenewals,
+			"достигнут лимит продлений (%d)", rule.MaxRenewals)
+	}
+
+	waiting, err := waitingEntries(tx, bookID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(waiting) > 0 {
+		return time.Time{}, policy.Deny(policy.ReasonWaitlist,
+			"книгу ждут другие читатели (в очереди: %d)", len(waiting))
+	}
+
+	newEnd := end.AddDate(0, 0, days)
+	limit := start.AddDate(0, 0, maxDays)
+	if newEnd.After(limit) {
+		left := int(limit.Sub(end).Hours() / 24)
+		if left <= 0 {
+			return time.Time{}, policy.Deny(policy.ReasonMaxDuration,
+				"достигнут максимальный срок (%d дн.)", maxDays)
+		}
+		return time.Time{}, policy.Deny(policy.ReasonMaxDuration,
+			"превышен максимальный срок (%d дн.), можно продлить не более чем на %d дн.", maxDays, left)
+	}
+	return newEnd, nil
+}
+
+// RenewReservation продлевает активную бронь на days дней
+// (срок продления по правилам выдачи, если days = 0). Если userEmail задан,
+// продлить можно только свою бронь.
+func (lib *Library) RenewReservation(reservationID int, userEmail string, days int) (*models.Reservation, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var reservation *models.Reservation
+	err := lib.repo.Update("RenewReservation", func(tx storage.Tx) error {
+		var err error
+		reservation, err = tx.Reservation(reservationID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("бронь не найдена")
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkOwner(reservation.UserEmail, userEmail); err != nil {
+			return err
+		}
+		if reservation.Status != "active" {
+			return policy.Deny(policy.ReasonNotActive, "бронь не активна (статус %s)", reservation.Status)
+		}
+
+		rule := lib.ruleForCopy(tx, reservation.UserEmail, reservation.CopyID)
+		if days == 0 {
+			days = rule.ReservationRenewalDays
+		}
+		newEnd, err := checkRenewal(tx, rule, reservation.BookID, reservation.StartDate, reservation.EndDate,
+			reservation.Renewals, days, rule.MaxReservationDays)
+		if err != nil {
+			return err
+		}
+
+		reservation.EndDate = newEnd
+		reservation.Renewals++
+		return tx.SaveReservation(reservation)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Бронь #%d продлена до %s\n", reservation.ID, reservation.EndDate.Format("02.01.2006"))
+	return reservation, nil
+}
+
+// RenewLoan продлевает выдачу на days дней (срок продления по правилам
+// выдачи, если days = 0). Если userEmail задан, продлить можно только свою выдачу.
+func (lib *Library) RenewLoan(loanID int, userEmail string, days int) (*models.Loan, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var loan *models.Loan
+	err := lib.repo.Update("RenewLoan", func(tx storage.Tx) error {
+		var err error
+		loan, err = tx.Loan(loanID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("выдача не найдена")
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkOwner(loan.UserEmail, userEmail); err != nil {
+			return err
+		}
+		if loan.Status != models.LoanActive {
+			return policy.Deny(policy.ReasonNotActive, "выдача не активна (статус %s)", loan.Status)
+		}
+
+		rule := lib.ruleForCopy(tx, loan.UserEmail, loan.CopyID)
+		if days == 0 {
+			days = rule.LoanRenewalDays
+		}
+		newDue, err := checkRenewal(tx, rule, loan.BookID, loan.CheckoutDate, loan.DueDate,
+			loan.Renewals, days, rule.MaxLoanDays)
+		if err != nil {
+			return err
+		}
+
+		loan.DueDate = newDue
+		loan.Renewals++
+		// О новом сроке напомним ещё раз
+		loan.RemindedAt = nil
+		return tx.SaveLoan(loan)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Выдача #%d продлена до %s\n", loan.ID, loan.DueDate.Format("02.01.2006"))
+	return loan, nil
+}
@@ -1,8 +1,12 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"library-app/internal/events"
 	"library-app/internal/models"
+	"library-app/internal/storage"
 	"sync"
 	"time"
 )
@@ -11,11 +15,13 @@ type ReservationService struct {
 	ReservationQueue chan *models.Reservation
 	RWorkers         int
 	RWG              sync.WaitGroup
+	closeMu          sync.RWMutex
+	closed           bool
 }
 
-func NewReservationService(rWorkers int) *ReservationService {
+func NewReservationService(rWorkers, queueSize int) *ReservationService {
 	rs := &ReservationService{
-		ReservationQueue: make(chan *models.Reservation, 100),
+		ReservationQueue: make(chan *models.Reservation, queueSize),
 		RWorkers:         rWorkers,
 	}
 
@@ -38,87 +44,185 @@ func (rs *ReservationService) reservationWorker(id int) {
 	fmt.Printf("Работник резервации #%d остановлен\n", id)
 }
 
-func (lib *Library) ReserveBook(bookID int, userEmail string, days int) error {
-	lib.mu.Lock()
+func (rs *ReservationService) enqueue(reservation *models.Reservation) bool {
+	rs.closeMu.RLock()
+	defer rs.closeMu.RUnlock()
 
-	book := lib.findBookUnsafe(bookID)
-	if book == nil {
-		lib.mu.Unlock()
-		return fmt.Errorf("книга не найдена")
+	if rs.closed {
+		return false
+	}
+	select {
+	case rs.ReservationQueue <- reservation:
+		return true
+	default:
+		return false
 	}
+}
 
-	if !book.IsAvailable {
-		lib.mu.Unlock()
-		return fmt.Errorf("книга не доступна")
+// Shutdown закрывает очередь и ждёт, пока обработчики разберут
+// принятые брони, но не дольше, чем позволяет ctx. Сами брони
+// к этому моменту уже сохранены в хранилище.
+func (rs *ReservationService) Shutdown(ctx context.Context) error {
+	rs.closeMu.Lock()
+	if !rs.closed {
+		rs.closed = true
+		close(rs.ReservationQueue)
 	}
+	rs.closeMu.Unlock()
 
-	if lib.getUserActiveReservationsUnsafe(userEmail) >= 3 {
-		lib.mu.Unlock()
-		return fmt.Errorf("пользователь достиг лимита резервации (3 активные резервации)")
+	if err := waitGroup(ctx, &rs.RWG); err != nil {
+		return fmt.Errorf("не обработано броней в очереди: %d: %w", len(rs.ReservationQueue), err)
 	}
+	fmt.Printf("Обработчики броней остановлены\n")
+	return nil
+}
 
+// ReserveBook бронирует экземпляр copyID книги или, если он не указан,
+// любой доступный экземпляр. days = 0 - срок брони по правилам выдачи.
+func (lib *Library) ReserveBook(bookID int, userEmail string, days int, copyID int) error {
+	lib.mu.Lock()
+
+	now := lib.now()
 	reservation := &models.Reservation{
-		ID:        lib.ReservationID,
 		BookID:    bookID,
 		UserEmail: userEmail,
-		StartDate: time.Now(),
-		EndDate:   time.Now().AddDate(0, 0, days),
+		StartDate: now,
 		Status:    "active",
 	}
 
-	lib.ReservationsSlice = append(lib.ReservationsSlice, reservation)
-	book.IsAvailable = false
-	lib.ReservationID++
+	err := lib.update("ReserveBook", func(tx storage.Tx, emit emitFunc) error {
+		if _, err := activePatron(tx, userEmail, now); err != nil {
+			return err
+		}
+		if _, err := findBookTx(tx, bookID); err != nil {
+			return err
+		}
+
+		c, err := pickCopy(tx, bookID, copyID)
+		if err != nil {
+			return err
+		}
+
+		rule := lib.rule(tx, userEmail, c)
+		period, err := rule.ReservationPeriod(days)
+		if err != nil {
+			return err
+		}
+		active, err := userActiveReservations(tx, userEmail)
+		if err != nil {
+			return err
+		}
+		if err := rule.CheckReservations(active); err != nil {
+			return err
+		}
+
+		reservation.CopyID = c.ID
+		reservation.EndDate = now.AddDate(0, 0, period)
+		if err := tx.SaveReservation(reservation); err != nil {
+			return err
+		}
+		if err := setCopyStatus(tx, c, models.CopyReserved); err != nil {
+			return err
+		}
+		return emit(events.ReservationCreated{Reservation: reservation})
+	})
 
 	lib.mu.Unlock()
 
-	select {
-	case lib.Reservations.ReservationQueue <- reservation:
+	if errors.Is(err, storage.ErrConflict) {
+		return ErrNoCopyAvailable
+	}
+	if err != nil {
+		return err
+	}
+
+	if lib.Reservations.enqueue(reservation) {
 		fmt.Printf("Книга зарезервирована работником, ID -> %d в очереди\n", reservation.ID)
-	default:
+	} else {
 		fmt.Printf("Очередь резервации переполнена\n")
 	}
 
 	return nil
 }
 
-func (lib *Library) getUserActiveReservationsUnsafe(userEmail string) int {
+// releaseCopy освобождает экземпляр брони, если он ещё существует,
+// и возвращает брони, созданные для очереди ожидания.
+func (lib *Library) releaseCopy(tx storage.Tx, reservation *models.Reservation, now time.Time) ([]*models.Reservation, error) {
+	c, err := tx.Copy(reservation.CopyID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lib.freeCopy(tx, c, now)
+}
+
+func userActiveReservations(tx storage.Reader, userEmail string) (int, error) {
+	reservations, err := tx.Reservations()
+	if err != nil {
+		return 0, err
+	}
+
 	count := 0
-	for _, reservation := range lib.ReservationsSlice {
+	for _, reservation := range reservations {
 		if reservation.UserEmail == userEmail && reservation.Status == "active" {
 			count++
 		}
 	}
-	return count
+	return count, nil
 }
 
-func (lib *Library) CancelReservation(reservationID int) error {
+// CancelReservation отменяет бронь. Если userEmail задан, отменить можно
+// только свою бронь.
+func (lib *Library) CancelReservation(reservationID int, userEmail string) error {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	for i, reservation := range lib.ReservationsSlice {
-		if reservation.ID == reservationID {
-			bookID := reservation.BookID
-
-			lib.ReservationsSlice = append(lib.ReservationsSlice[:i], lib.ReservationsSlice[i+1:]...)
+	err := lib.update("CancelReservation", func(tx storage.Tx, emit emitFunc) error {
+		reservation, err := tx.Reservation(reservationID)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("бронь не найдена")
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkOwner(reservation.UserEmail, userEmail); err != nil {
+			return err
+		}
 
-			if book := lib.findBookUnsafe(bookID); book != nil {
-				book.IsAvailable = true
-			}
+		if err := tx.DeleteReservation(reservationID); err != nil {
+			return err
+		}
+		if err := emit(events.ReservationCancelled{Reservation: reservation}); err != nil {
+			return err
+		}
 
-			fmt.Printf("Бронь #%d отменена\n", reservationID)
+		if reservation.Status != "active" {
 			return nil
 		}
+		holds, err := lib.releaseCopy(tx, reservation, lib.now())
+		if err != nil {
+			return err
+		}
+		return emitHolds(emit, holds)
+	})
+	if err != nil {
+		return err
 	}
-	return fmt.Errorf("бронь не найдена")
+
+	fmt.Printf("Бронь #%d отменена\n", reservationID)
+	return nil
 }
 
 func (lib *Library) GetUserReservation(userEmail string) []*models.Reservation {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
+	reservations, _ := lib.repo.Reservations()
+
 	var resers []*models.Reservation
-	for _, reservation := range lib.ReservationsSlice {
+	for _, reservation := range reservations {
 		if reservation.UserEmail == userEmail {
 			resers = append(resers, reservation)
 		}
@@ -134,58 +238,80 @@ func (lib *Library) ProcessExpiredReservations() {
 	lib.mu.Lock()
 	defer lib.mu.Unlock()
 
-	now := time.Now()
-	expiredCount := 0
+	now := lib.now()
+	var expired []*models.Reservation
+
+	err := lib.update("ProcessExpiredReservations", func(tx storage.Tx, emit emitFunc) error {
+		expired = nil
+
+		reservations, err := tx.Reservations()
+		if err != nil {
+			return err
+		}
 
-	for i := 0; i < len(lib.ReservationsSlice); i++ {
-		reservation := lib.ReservationsSlice[i]
+		for _, reservation := range reservations {
+			if reservation.Status != "active" || !reservation.EndDate.Before(now) {
+				continue
+			}
 
-		if reservation.Status == "active" && reservation.EndDate.Before(now) {
 			fmt.Printf("Бронь %d просрочена для пользователя %s\n", reservation.ID, reservation.UserEmail)
 
 			reservation.Status = "expired"
+			if err := tx.SaveReservation(reservation); err != nil {
+				return err
+			}
 
-			if book := lib.findBookUnsafe(reservation.BookID); book != nil {
-				book.IsAvailable = true
+			promoted, err := lib.releaseCopy(tx, reservation, now)
+			if err != nil {
+				return err
+			}
+			if err := emit(events.ReservationExpired{Reservation: reservation}); err != nil {
+				return err
+			}
+			if err := emitHolds(emit, promoted); err != nil {
+				return err
+			}
+			if book, err := tx.Book(reservation.BookID); err == nil {
 				fmt.Printf("Книга %s снова доступна\n", book.Title)
 			}
 
-			expiredCount++
-
-			go lib.SendExpirationNotification(reservation.ID, reservation.UserEmail)
+			expired = append(expired, reservation)
+		}
+		if err := expireMemberships(tx, now); err != nil {
+			return err
+		}
+		if err := remindDueSoon(tx, emit, now); err != nil {
+			return err
 		}
+		return lib.accrueOverdueFines(tx, now)
+	})
+	if err != nil {
+		fmt.Printf("Ошибка обработки просроченных броней: %v\n", err)
+		return
 	}
 
-	if expiredCount > 0 {
-		fmt.Printf("Обработано просроченных броней: %d\n", expiredCount)
+	if len(expired) > 0 {
+		fmt.Printf("Обработано просроченных броней: %d\n", len(expired))
 	}
 }
 
-func (lib *Library) StartExpirationChecker() {
+// StartExpirationChecker периодически обрабатывает просроченные брони,
+// пока не отменён ctx.
+func (lib *Library) StartExpirationChecker(ctx context.Context, interval time.Duration) {
+	lib.loops.Add(1)
 	go func() {
-		ticker := time.NewTicker(1 * time.Minute)
+		defer lib.loops.Done()
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for {
 			select {
 			case <-ticker.C:
 				lib.ProcessExpiredReservations()
+			case <-ctx.Done():
+				fmt.Println("Проверка просроченных броней остановлена")
+				return
 			}
 		}
 	}()
 }
-
-func (lib *Library) SendExpirationNotification(reservationID int, userEmail string) {
-	notification := &models.EmailNotification{
-		To:      userEmail,
-		Subject: "Бронь просрочена",
-		Message: fmt.Sprintf("Ваша бронь #%d автоматически отменена due to expiration", reservationID),
-	}
-
-	select {
-	case lib.Notifications.EmailQueue <- notification:
-		fmt.Printf("Уведомление о просрочке отправлено\n")
-	default:
-		fmt.Printf("Очередь переполнена\n")
-	}
-}
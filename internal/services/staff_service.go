@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+)
+
+func accountResponse(a *models.Account) dto.AccountResponse {
+	role := a.Role
+	if role == "" {
+		role = models.RolePatron
+	}
+	return dto.AccountResponse{
+		ID:        a.ID,
+		Email:     a.Email,
+		Role:      role,
+		CreatedAt: a.CreatedAt,
+	}
+}
+
+func (lib *Library) FindAccount(email string) (dto.AccountResponse, error) {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	account, err := accountByEmail(lib.repo, email)
+	if err != nil {
+		return dto.AccountResponse{}, fmt.Errorf("учётная запись не найдена")
+	}
+	return accountResponse(account), nil
+}
+
+// CreateStaffAccount заводит учётную запись библиотекаря или администратора.
+func (lib *Library) CreateStaffAccount(email, password, role string) (dto.AccountResponse, error) {
+	if role != models.RoleLibrarian && role != models.RoleAdmin {
+		return dto.AccountResponse{}, fmt.Errorf("роль сотрудника может быть только %q или %q",
+			models.RoleLibrarian, models.RoleAdmin)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return dto.AccountResponse{}, err
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var account *models.Account
+	err = lib.repo.Update("CreateStaffAccount", func(tx storage.Tx) error {
+		account, err = createAccount(tx, email, hash, role, lib.now())
+		return err
+	})
+	if err != nil {
+		return dto.AccountResponse{}, err
+	}
+
+	fmt.Printf("Создана учётная запись сотрудника %s (%s)\n", email, role)
+	return accountResponse(account), nil
+}
+
+func (lib *Library) GetStaffAccounts() []dto.AccountResponse {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	accounts, _ := lib.repo.Accounts()
+	result := []dto.AccountResponse{}
+	for _, a := range accounts {
+		if a.Role == models.RoleLibrarian || a.Role == models.RoleAdmin {
+			result = append(result, accountResponse(a))
+		}
+	}
+	return result
+}
+
+// SetAccountRole меняет роль учётной записи. Последнего администратора
+// понизить нельзя, иначе управлять сотрудниками станет некому.
+func (lib *Library) SetAccountRole(email, role string) (dto.AccountResponse, error) {
+	if !models.ValidRole(role) {
+		return dto.AccountResponse{}, fmt.Errorf("неизвестная роль %q", role)
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var account *models.Account
+	err := lib.repo.Update("SetAccountRole", func(tx storage.Tx) error {
+		var err error
+		account, err = accountByEmail(tx, email)
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("учётная запись не найдена")
+		}
+		if err != nil {
+			return err
+		}
+
+		if account.Role == models.RoleAdmin && role != models.RoleAdmin {
+			accounts, err := tx.Accounts()
+			if err != nil {
+				return err
+			}
+			admins := 0
+			for _, a := range accounts {
+				if a.Role == models.RoleAdmin {
+					admins++
+				}
+			}
+			if admins <= 1 {
+				return fmt.Errorf("нельзя понизить последнего администратора")
+			}
+		}
+
+		account.Role = role
+		account.UpdatedAt = lib.now()
+		return tx.SaveAccount(account)
+	})
+	if err != nil {
+		return dto.AccountResponse{}, err
+	}
+	return accountResponse(account), nil
+}
+
+// EnsureAdmin создаёт учётную запись администратора, если её ещё нет.
+// Используется при первом запуске, когда сотрудников в системе нет.
+func (lib *Library) EnsureAdmin(email, password string) error {
+	if _, err := lib.FindAccount(email); err == nil {
+		return nil
+	}
+	_, err := lib.CreateStaffAccount(email, password, models.RoleAdmin)
+	return err
+}
@@ -0,0 +1,222 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"time"
+)
+
+// holdPickupDays - сколько дней держится бронь, созданная из очереди.
+// Не забрал вовремя - бронь истекает и книга уходит следующему.
+const holdPickupDays = 3
+
+var (
+	ErrNoCopyAvailable = errors.New("книга не доступна")
+	ErrBookInUse       = errors.New("книгу нельзя удалить")
+)
+
+// freeCopy делает экземпляр доступным и сразу отдаёт его очереди ожидания.
+func (lib *Library) freeCopy(tx storage.Tx, c *models.Copy, now time.Time) ([]*models.Reservation, error) {
+	if err := setCopyStatus(tx, c, models.CopyAvailable); err != nil {
+		return nil, err
+	}
+	return lib.promoteWaitlist(tx, c.BookID, now)
+}
+
+func waitingEntries(tx storage.Reader, bookID int) ([]*models.WaitlistEntry, error) {
+	all, err := tx.Waitlist()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*models.WaitlistEntry
+	for _, entry := range all {
+		if entry.BookID == bookID && entry.Status == models.WaitlistWaiting {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// promoteWaitlist раздаёт свободные экземпляры книги первым в очереди,
+// создавая для них брони на holdPickupDays дней. Читатели, которые сейчас
+// не могут бронировать (билет приостановлен или истёк, достигнут лимит
+// броней), пропускаются и остаются в очереди.
+func (lib *Library) promoteWaitlist(tx storage.Tx, bookID int, now time.Time) ([]*models.Reservation, error) {
+	entries, err := waitingEntries(tx, bookID)
+	if err != nil {
+		return nil, err
+	}
+
+	var holds []*models.Reservation
+	for _, entry := range entries {
+		c, err := firstAvailableCopy(tx, bookID)
+		if err != nil {
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+
+		eligible, err := lib.canHold(tx, entry.UserEmail, c, now)
+		if err != nil {
+			return nil, err
+		}
+		if !eligible {
+			continue
+		}
+
+		hold := &models.Reservation{
+			BookID:    bookID,
+			CopyID:    c.ID,
+			UserEmail: entry.UserEmail,
+			StartDate: now,
+			EndDate:   now.AddDate(0, 0, holdPickupDays),
+			Status:    "active",
+		}
+		if err := tx.SaveReservation(hold); err != nil {
+			return nil, err
+		}
+		if err := setCopyStatus(tx, c, models.CopyReserved); err != nil {
+			return nil, err
+		}
+
+		entry.Status = models.WaitlistFulfilled
+		entry.ReservationID = hold.ID
+		if err := tx.SaveWaitlistEntry(entry); err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Экземпляр %s отложен для %s из очереди\n", c.Barcode, entry.UserEmail)
+		holds = append(holds, hold)
+	}
+	return holds, nil
+}
+
+// canHold проверяет, можно ли сейчас отложить читателю экземпляр c, так
+// же как ReserveBook: билет действует и лимит броней не достигнут.
+func (lib *Library) canHold(tx storage.Reader, userEmail string, c *models.Copy, now time.Time) (bool, error) {
+	_, err := activePatron(tx, userEmail, now)
+	if errors.Is(err, ErrUnknownPatron) || errors.Is(err, ErrPatronInactive) {
+		fmt.Printf("Читатель %s пропущен в очереди: %v\n", userEmail, err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	active, err := userActiveReservations(tx, userEmail)
+	if err != nil {
+		return false, err
+	}
+	if err := lib.rule(tx, userEmail, c).CheckReservations(active); err != nil {
+		fmt.Printf("Читатель %s пропущен в очереди: %v\n", userEmail, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// JoinWaitlist ставит читателя в очередь на книгу и возвращает его место.
+func (lib *Library) JoinWaitlist(bookID int, userEmail string) (int, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	position := 0
+	err := lib.repo.Update("JoinWaitlist", func(tx storage.Tx) error {
+		if _, err := activePatron(tx, userEmail, lib.now()); err != nil {
+			return err
+		}
+		if _, err := findBookTx(tx, bookID); err != nil {
+			return err
+		}
+
+		c, err := firstAvailableCopy(tx, bookID)
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			return fmt.Errorf("книга доступна, её можно забронировать сразу")
+		}
+
+		hold, err := userHold(tx, bookID, userEmail, 0)
+		if err != nil {
+			return err
+		}
+		if hold != nil {
+			return fmt.Errorf("у пользователя уже есть бронь этой книги")
+		}
+
+		entries, err := waitingEntries(tx, bookID)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.UserEmail == userEmail {
+				return fmt.Errorf("пользователь уже в очереди на эту книгу")
+			}
+		}
+
+		position = len(entries) + 1
+		return tx.SaveWaitlistEntry(&models.WaitlistEntry{
+			BookID:    bookID,
+			UserEmail: userEmail,
+			CreatedAt: lib.now(),
+			Status:    models.WaitlistWaiting,
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	fmt.Printf("Пользователь %s встал в очередь на книгу #%d, место %d\n", userEmail, bookID, position)
+	return position, nil
+}
+
+func (lib *Library) LeaveWaitlist(bookID int, userEmail string) error {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	return lib.repo.Update("LeaveWaitlist", func(tx storage.Tx) error {
+		entries, err := waitingEntries(tx, bookID)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.UserEmail == userEmail {
+				entry.Status = models.WaitlistCancelled
+				return tx.SaveWaitlistEntry(entry)
+			}
+		}
+		return fmt.Errorf("пользователь не стоит в очереди на эту книгу")
+	})
+}
+
+// WaitlistPosition возвращает место читателя в очереди (с 1).
+func (lib *Library) WaitlistPosition(bookID int, userEmail string) (int, error) {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	entries, err := waitingEntries(lib.repo, bookID)
+	if err != nil {
+		return 0, err
+	}
+	for i, entry := range entries {
+		if entry.UserEmail == userEmail {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("пользователь не стоит в очереди на эту книгу")
+}
+
+func (lib *Library) GetWaitlist(bookID int) []*models.WaitlistEntry {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	entries, _ := waitingEntries(lib.repo, bookID)
+	if entries == nil {
+		entries = []*models.WaitlistEntry{}
+	}
+	return entries
+}
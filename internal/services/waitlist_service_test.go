@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/email"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"testing"
+)
+
+// addBooks добавляет книги по одному экземпляру и возвращает их ID.
+func addBooks(t *testing.T, lib *Library, n int) []int {
+	t.Helper()
+	var ids []int
+	err := lib.repo.Update("AddBooks", func(tx storage.Tx) error {
+		author := &models.Author{Person: models.Person{Name: "Антон Чехов"}}
+		if err := tx.SaveAuthor(author); err != nil {
+			return err
+		}
+		for i := range n {
+			book := &models.Book{Title: fmt.Sprintf("Книга %d", i+1), AuthorID: author.AuthorID, IsAvailable: true}
+			if err := tx.SaveBook(book); err != nil {
+				return err
+			}
+			c := &models.Copy{BookID: book.ID, Barcode: fmt.Sprintf("LIB-%d", i+1), ItemType: "book", Status: models.CopyAvailable}
+			if err := tx.SaveCopy(c); err != nil {
+				return err
+			}
+			ids = append(ids, book.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func addPatrons(t *testing.T, lib *Library, emails ...string) {
+	t.Helper()
+	now := lib.now()
+	err := lib.repo.Update("AddPatrons", func(tx storage.Tx) error {
+		for _, e := range emails {
+			err := tx.SavePatron(&models.Patron{
+				Person:       models.Person{Name: e, Email: e},
+				Category:     models.DefaultPatronCategory,
+				Status:       models.PatronActive,
+				RegisteredAt: now,
+				ExpiresAt:    now.AddDate(1, 0, 0),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPromoteWaitlistSkipsIneligiblePatrons(t *testing.T) {
+	lib, _ := newTestLibrary(t, email.NewFake())
+	books := addBooks(t, lib, 4)
+	addPatrons(t, lib, "holder@example.com", "suspended@example.com", "busy@example.com", "reader@example.com")
+
+	if err := lib.ReserveBook(books[0], "holder@example.com", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []string{"suspended@example.com", "busy@example.com", "reader@example.com"} {
+		if _, err := lib.JoinWaitlist(books[0], e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Первого в очереди приостановили, второй набрал лимит броней
+	suspended := models.PatronSuspended
+	if _, err := lib.UpdatePatron("suspended@example.com", dto.UpdatePatronRequest{Status: &suspended}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range books[1:] {
+		if err := lib.ReserveBook(id, "busy@example.com", 0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	holder := lib.GetUserReservation("holder@example.com")
+	if err := lib.CancelReservation(holder[0].ID, "holder@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	holds := lib.GetUserReservation("reader@example.com")
+	if len(holds) != 1 || holds[0].BookID != books[0] || holds[0].Status != "active" {
+		t.Fatalf("брони третьего в очереди: %v", holds)
+	}
+	// Пропущенные остаются в очереди на своих местах
+	for want, e := range []string{"suspended@example.com", "busy@example.com"} {
+		position, err := lib.WaitlistPosition(books[0], e)
+		if err != nil || position != want+1 {
+			t.Fatalf("%s в очереди на месте %d, ожидалось %d: %v", e, position, want+1, err)
+		}
+	}
+	if held := lib.GetUserReservation("busy@example.com"); len(held) != 3 {
+		t.Fatalf("броней у читателя на лимите: %d", len(held))
+	}
+}
@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"library-app/internal/dto"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"library-app/internal/webhook"
+	"net/url"
+	"slices"
+	"time"
+)
+
+var (
+	ErrUnknownWebhook  = errors.New("подписка не найдена")
+	ErrUnknownDelivery = errors.New("доставка не найдена")
+)
+
+func webhookResponse(w *models.Webhook) dto.WebhookResponse {
+	return dto.WebhookResponse{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.Events,
+		Active:    w.Active,
+		CreatedBy: w.CreatedBy,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+func deliveryResponse(d *models.WebhookDelivery) dto.WebhookDeliveryResponse {
+	return dto.WebhookDeliveryResponse{
+		ID:            d.ID,
+		WebhookID:     d.WebhookID,
+		Event:         d.Event,
+		Status:        d.Status,
+		Attempts:      d.Attempts,
+		ResponseCode:  d.ResponseCode,
+		LastError:     d.LastError,
+		NextAttemptAt: d.NextAttemptAt,
+		DeliveredAt:   d.DeliveredAt,
+		CreatedAt:     d.CreatedAt,
+		Payload:       json.RawMessage(d.Payload),
+	}
+}
+
+func validateWebhook(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("адрес вебхука должен быть http(s)-ссылкой")
+	}
+	for _, event := range events {
+		if !slices.Contains(models.WebhookEvents, event) {
+			return fmt.Errorf("неизвестное событие %q", event)
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CreateWebhook подписывает адрес на события. Секрет для проверки
+// подписи возвращается только здесь.
+func (lib *Library) CreateWebhook(req dto.CreateWebhookRequest, createdBy string) (dto.WebhookResponse, error) {
+	if req.Events == nil {
+		req.Events = []string{}
+	}
+	if err := validateWebhook(req.URL, req.Events); err != nil {
+		return dto.WebhookResponse{}, err
+	}
+	if req.Secret == "" {
+		req.Secret = newWebhookSecret()
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	w := &models.Webhook{
+		URL:       req.URL,
+		Secret:    req.Secret,
+		Events:    req.Events,
+		Active:    true,
+		CreatedBy: createdBy,
+		CreatedAt: lib.now(),
+	}
+	err := lib.repo.Update("CreateWebhook", func(tx storage.Tx) error {
+		return tx.SaveWebhook(w)
+	})
+	if err != nil {
+		return dto.WebhookResponse{}, err
+	}
+
+	fmt.Printf("Создана подписка #%d на %s, события: %v\n", w.ID, w.URL, w.Events)
+	resp := webhookResponse(w)
+	resp.Secret = w.Secret
+	return resp, nil
+}
+
+func (lib *Library) GetWebhooks() []dto.WebhookResponse {
+	lib.mu.RLock()
+	defer lib.mu.RUnlock()
+
+	webhooks, _ := lib.repo.Webhooks()
+	result := []dto.WebhookResponse{}
+	for _, w := range webhooks {
+		result = append(result, webhookResponse(w))
+	}
+	return result
+}
+
+func (lib *Library) FindWebhook(id int) (dto.WebhookResponse, error) {
+	w, err := lib.repo.Webhook(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return dto.WebhookResponse{}, ErrUnknownWebhook
+	}
+	if err != nil {
+		return dto.WebhookResponse{}, err
+	}
+	return webhookResponse(w), nil
+}
+
+func (lib *Library) UpdateWebhook(id int, req dto.UpdateWebhookRequest) (dto.WebhookResponse, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var w *models.Webhook
+	err := lib.repo.Update("UpdateWebhook", func(tx storage.Tx) error {
+		var err error
+		w, err = tx.Webhook(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrUnknownWebhook
+		}
+		if err != nil {
+			return err
+		}
+
+		if req.URL != nil {
+			w.URL = *req.URL
+		}
+		if req.Events != nil {
+			w.Events = *req.Events
+			if w.Events == nil {
+				w.Events = []string{}
+			}
+		}
+		if req.Secret != nil {
+			if *req.Secret == "" {
+				return fmt.Errorf("секрет не может быть пустым")
+			}
+			w.Secret = *req.Secret
+		}
+		if req.Active != nil {
+			w.Active = *req.Active
+		}
+		if err := validateWebhook(w.URL, w.Events); err != nil {
+			return err
+		}
+		return tx.SaveWebhook(w)
+	})
+	if err != nil {
+		return dto.WebhookResponse{}, err
+	}
+	return webhookResponse(w), nil
+}
+
+// DeleteWebhook удаляет подписку вместе с журналом доставок.
+func (lib *Library) DeleteWebhook(id int) error {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	err := lib.repo.Update("DeleteWebhook", func(tx storage.Tx) error {
+		return tx.DeleteWebhook(id)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return ErrUnknownWebhook
+	}
+	return err
+}
+
+// WebhookDeliveries - журнал доставок подписки, новые сначала.
+func (lib *Library) WebhookDeliveries(webhookID int) ([]dto.WebhookDeliveryResponse, error) {
+	if _, err := lib.FindWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := lib.repo.WebhookDeliveries()
+	if err != nil {
+		return nil, err
+	}
+	result := []dto.WebhookDeliveryResponse{}
+	for _, d := range slices.Backward(deliveries) {
+		if d.WebhookID == webhookID {
+			result = append(result, deliveryResponse(d))
+		}
+	}
+	return result, nil
+}
+
+// webhookEvent - тело запроса вебхука.
+type webhookEvent struct {
+	Event      string    `json:"event"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Data       any       `json:"data"`
+}
+
+// emitWebhook записывает доставку события для каждой подписки на него
+// в той же транзакции, что и само событие, как письма в notify.
+// Отправляет их диспетчер вебхуков после фиксации.
+func (lib *Library) emitWebhook(tx storage.Tx, event string, data any) error {
+	webhooks, err := tx.Webhooks()
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	now := lib.now()
+	for _, w := range webhooks {
+		if !w.Wants(event) {
+			continue
+		}
+		if payload == nil {
+			payload, err = json.Marshal(webhookEvent{Event: event, OccurredAt: now, Data: data})
+			if err != nil {
+				return err
+			}
+		}
+		delivery := &models.WebhookDelivery{
+			WebhookID: w.ID,
+			Event:     event,
+			Payload:   string(payload),
+			Status:    models.DeliveryPending,
+			CreatedAt: now,
+		}
+		if err := tx.SaveWebhookDelivery(delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reservationEvent и loanEvent - данные событий о бронях и выдачах.
+func reservationEvent(tx storage.Reader, reservation *models.Reservation) any {
+	return struct {
+		Reservation *models.Reservation `json:"reservation"`
+		Book        *models.Book        `json:"book,omitempty"`
+	}{reservation, eventBook(tx, reservation.BookID)}
+}
+
+func loanEvent(tx storage.Reader, loan *models.Loan) any {
+	return struct {
+		Loan *models.Loan `json:"loan"`
+		Book *models.Book `json:"book,omitempty"`
+	}{loan, eventBook(tx, loan.BookID)}
+}
+
+func eventBook(tx storage.Reader, bookID int) *models.Book {
+	book, err := tx.Book(bookID)
+	if err != nil {
+		return nil
+	}
+	return book
+}
+
+// PingWebhook ставит подписке проверочную доставку.
+func (lib *Library) PingWebhook(id int) (dto.WebhookDeliveryResponse, error) {
+	return lib.queueDelivery("PingWebhook", id, func(tx storage.Tx, w *models.Webhook) (*models.WebhookDelivery, error) {
+		payload, err := json.Marshal(webhookEvent{
+			Event:      models.WebhookPing,
+			OccurredAt: lib.now(),
+			Data:       map[string]int{"webhook_id": w.ID},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &models.WebhookDelivery{Event: models.WebhookPing, Payload: string(payload)}, nil
+	})
+}
+
+// RedeliverWebhook повторяет доставку deliveryID новой записью в журнале
+// с тем же телом. Исходная запись остаётся как была.
+func (lib *Library) RedeliverWebhook(id, deliveryID int) (dto.WebhookDeliveryResponse, error) {
+	return lib.queueDelivery("RedeliverWebhook", id, func(tx storage.Tx, w *models.Webhook) (*models.WebhookDelivery, error) {
+		original, err := tx.WebhookDelivery(deliveryID)
+		if errors.Is(err, storage.ErrNotFound) || err == nil && original.WebhookID != w.ID {
+			return nil, ErrUnknownDelivery
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &models.WebhookDelivery{Event: original.Event, Payload: original.Payload}, nil
+	})
+}
+
+func (lib *Library) queueDelivery(op string, id int, build func(storage.Tx, *models.Webhook) (*models.WebhookDelivery, error)) (dto.WebhookDeliveryResponse, error) {
+	lib.mu.Lock()
+	var delivery *models.WebhookDelivery
+	err := lib.repo.Update(op, func(tx storage.Tx) error {
+		w, err := tx.Webhook(id)
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrUnknownWebhook
+		}
+		if err != nil {
+			return err
+		}
+
+		delivery, err = build(tx, w)
+		if err != nil {
+			return err
+		}
+		delivery.WebhookID = w.ID
+		delivery.Status = models.DeliveryPending
+		delivery.CreatedAt = lib.now()
+		return tx.SaveWebhookDelivery(delivery)
+	})
+	lib.mu.Unlock()
+	if err != nil {
+		return dto.WebhookDeliveryResponse{}, err
+	}
+
+	lib.wakeOutbox()
+	return deliveryResponse(delivery), nil
+}
+
+// DeliverWebhooks отправляет новые доставки и те, которым подошёл срок
+// повтора. Доставки отключённых подписок ждут их включения.
+func (lib *Library) DeliverWebhooks(ctx context.Context) {
+	deliveries, err := lib.repo.WebhookDeliveries()
+	if err != nil {
+		fmt.Printf("Ошибка чтения доставок вебхуков: %v\n", err)
+		return
+	}
+
+	now := lib.now()
+	for _, d := range deliveries {
+		due := d.Status == models.DeliveryPending ||
+			d.Status == models.DeliveryRetrying && d.NextAttemptAt != nil && !d.NextAttemptAt.After(now)
+		if !due {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		w, err := lib.repo.Webhook(d.WebhookID)
+		if err != nil || !w.Active {
+			continue
+		}
+		code, sendErr := lib.Webhooks.Deliver(ctx, webhook.Request{
+			URL:        w.URL,
+			Secret:     w.Secret,
+			Event:      d.Event,
+			DeliveryID: d.ID,
+			Payload:    []byte(d.Payload),
+		}, lib.now())
+		if ctx.Err() != nil {
+			// Остановка сервера - попытка не считается
+			return
+		}
+		lib.recordWebhookDelivery(d, code, sendErr)
+	}
+}
+
+func (lib *Library) recordWebhookDelivery(d *models.WebhookDelivery, code int, sendErr error) {
+	now := lib.now()
+	d.Attempts++
+	d.ResponseCode = code
+	d.NextAttemptAt = nil
+
+	switch {
+	case sendErr == nil:
+		d.Status = models.DeliveryDelivered
+		d.DeliveredAt = &now
+		d.LastError = ""
+	case webhook.IsPermanent(sendErr) || d.Attempts >= lib.webhookRetry.MaxAttempts:
+		d.Status = models.DeliveryDead
+		d.LastError = sendErr.Error()
+		fmt.Printf("Вебхук #%d: доставка #%d не удалась после %d попыток: %v\n",
+			d.WebhookID, d.ID, d.Attempts, sendErr)
+	default:
+		next := now.Add(lib.webhookRetry.Backoff(d.Attempts))
+		d.Status = models.DeliveryRetrying
+		d.NextAttemptAt = &next
+		d.LastError = sendErr.Error()
+	}
+
+	err := lib.repo.Update("RecordWebhookDelivery", func(tx storage.Tx) error {
+		return tx.SaveWebhookDelivery(d)
+	})
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		fmt.Printf("Не удалось сохранить доставку вебхука #%d: %v\n", d.ID, err)
+	}
+}
+
+// StartWebhookDispatcher отправляет доставки вебхуков: сразу после
+// новых событий и раз в interval для повторов, пока не отменён ctx.
+func (lib *Library) StartWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	lib.loops.Add(1)
+	go func() {
+		defer lib.loops.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lib.DeliverWebhooks(ctx)
+		for {
+			select {
+			case <-ticker.C:
+				lib.DeliverWebhooks(ctx)
+			case <-lib.webhookWake:
+				lib.DeliverWebhooks(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
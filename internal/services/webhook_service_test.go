@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"io"
+	"library-app/internal/clock"
+	"library-app/internal/dto"
+	"library-app/internal/email"
+	"library-app/internal/models"
+	"library-app/internal/storage"
+	"library-app/internal/webhook"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestLibrary - библиотека в памяти с поддельной почтой и
+// симулированными часами.
+func newTestLibrary(t *testing.T, mailer *email.Fake) (*Library, *clock.Simulated) {
+	t.Helper()
+	lib := NewLibrary(storage.NewMemoryStore(), Options{
+		Mailer:             mailer,
+		EmailWorkers:       1,
+		EmailQueue:         10,
+		ReservationWorkers: 1,
+		ReservationQueue:   10,
+		Retry:              RetryPolicy{MaxAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour},
+		WebhookTimeout:     5 * time.Second,
+		WebhookRetry:       RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour},
+	})
+	sim := clock.NewSimulated()
+	lib.Clock = sim
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		lib.Shutdown(ctx)
+	})
+	return lib, sim
+}
+
+// receiver - получатель вебхуков, который проверяет подпись и отвечает
+// заданным кодом.
+type receiver struct {
+	mu     sync.Mutex
+	secret string
+	now    func() time.Time
+	status int
+	events []string
+	errs   []error
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, r.Header.Get(webhook.HeaderEvent))
+	if err := webhook.Verify(rc.secret, r.Header, body, time.Minute, rc.now()); err != nil {
+		rc.errs = append(rc.errs, err)
+	}
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) respond(status int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.status = status
+}
+
+// received - заголовки событий полученных запросов и ошибки подписи.
+func (rc *receiver) received() ([]string, []error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.events, rc.errs
+}
+
+func findDelivery(t *testing.T, lib *Library, webhookID, id int) dto.WebhookDeliveryResponse {
+	t.Helper()
+	deliveries, err := lib.WebhookDeliveries(webhookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range deliveries {
+		if d.ID == id {
+			return d
+		}
+	}
+	t.Fatalf("доставка #%d не найдена", id)
+	return dto.WebhookDeliveryResponse{}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	lib, sim := newTestLibrary(t, email.NewFake())
+	rc := &receiver{secret: "topsecret", now: sim.Now, status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	ctx := context.Background()
+
+	hook, err := lib.CreateWebhook(dto.CreateWebhookRequest{URL: srv.URL, Secret: "topsecret"}, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 503 - временный сбой: повтор позже
+	ping, err := lib.PingWebhook(hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib.DeliverWebhooks(ctx)
+
+	d := findDelivery(t, lib, hook.ID, ping.ID)
+	if d.Status != models.DeliveryRetrying || d.Attempts != 1 || d.ResponseCode != 503 {
+		t.Fatalf("после 503: статус %s, попыток %d, код %d", d.Status, d.Attempts, d.ResponseCode)
+	}
+	if d.NextAttemptAt == nil || !d.NextAttemptAt.After(sim.Now()) {
+		t.Fatalf("после 503 не назначен следующий повтор: %v", d.NextAttemptAt)
+	}
+	events, errs := rc.received()
+	if len(events) != 1 || events[0] != models.WebhookPing || len(errs) != 0 {
+		t.Fatalf("получены события %v, ошибки подписи: %v", events, errs)
+	}
+
+	// До срока повтора доставка не отправляется
+	lib.DeliverWebhooks(ctx)
+	if events, _ := rc.received(); len(events) != 1 {
+		t.Fatalf("доставка повторена раньше срока: %d запросов", len(events))
+	}
+
+	// Повторная доставка - новая запись с тем же телом; 400 - отказ без повторов
+	rc.respond(http.StatusBadRequest)
+	redelivery, err := lib.RedeliverWebhook(hook.ID, ping.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivery.ID == ping.ID || string(redelivery.Payload) != string(ping.Payload) {
+		t.Fatalf("повтор #%d с телом %s, исходная #%d с телом %s",
+			redelivery.ID, redelivery.Payload, ping.ID, ping.Payload)
+	}
+	lib.DeliverWebhooks(ctx)
+
+	d = findDelivery(t, lib, hook.ID, redelivery.ID)
+	if d.Status != models.DeliveryDead || d.Attempts != 1 || d.NextAttemptAt != nil {
+		t.Fatalf("после 400: статус %s, попыток %d, повтор %v", d.Status, d.Attempts, d.NextAttemptAt)
+	}
+	if d := findDelivery(t, lib, hook.ID, ping.ID); d.Status != models.DeliveryRetrying {
+		t.Fatalf("исходная доставка изменилась: %s", d.Status)
+	}
+
+	// Срок повтора наступил, получатель снова доступен
+	rc.respond(http.StatusOK)
+	if _, err := sim.Advance(2 * time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	lib.DeliverWebhooks(ctx)
+
+	d = findDelivery(t, lib, hook.ID, ping.ID)
+	if d.Status != models.DeliveryDelivered || d.Attempts != 2 || d.DeliveredAt == nil {
+		t.Fatalf("после 200: статус %s, попыток %d", d.Status, d.Attempts)
+	}
+	events, errs = rc.received()
+	if len(events) != 3 || len(errs) != 0 {
+		t.Fatalf("получено %d запросов, ошибки подписи: %v", len(events), errs)
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"library-app/internal/models"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ChangeSaveBook          = "save_book"
+	ChangeDeleteBook        = "delete_book"
+	ChangeSaveCopy          = "save_copy"
+	ChangeDeleteCopy        = "delete_copy"
+	ChangeSaveAuthor        = "save_author"
+	ChangeSaveReservation   = "save_reservation"
+	ChangeDeleteReservation = "delete_reservation"
+	ChangeSaveLoan          = "save_loan"
+	ChangeSaveWaitlistEntry = "save_waitlist_entry"
+	ChangeSaveFine          = "save_fine"
+	ChangeAddLedgerEntry    = "add_ledger_entry"
+	ChangeSavePatron        = "save_patron"
+	ChangeSaveAccount       = "save_account"
+	ChangeSaveAPIKey        = "save_api_key"
+	ChangeSaveNotification  = "save_notification"
+	ChangeSaveWebhook       = "save_webhook"
+	ChangeDeleteWebhook     = "delete_webhook"
+	ChangeSaveDelivery      = "save_webhook_delivery"
+)
+
+// Change - одно изменение строки внутри операции.
+type Change struct {
+	Op            string                    `json:"op"`
+	ID            int                       `json:"id,omitempty"`
+	Book          *models.Book              `json:"book,omitempty"`
+	Copy          *models.Copy              `json:"copy,omitempty"`
+	Author        *models.Author            `json:"author,omitempty"`
+	Reservation   *models.Reservation       `json:"reservation,omitempty"`
+	Loan          *models.Loan              `json:"loan,omitempty"`
+	WaitlistEntry *models.WaitlistEntry     `json:"waitlist_entry,omitempty"`
+	Fine          *models.Fine              `json:"fine,omitempty"`
+	LedgerEntry   *models.LedgerEntry       `json:"ledger_entry,omitempty"`
+	Patron        *models.Patron            `json:"patron,omitempty"`
+	Account       *models.Account           `json:"account,omitempty"`
+	APIKey        *models.APIKey            `json:"api_key,omitempty"`
+	Notification  *models.EmailNotification `json:"notification,omitempty"`
+	Webhook       *models.Webhook           `json:"webhook,omitempty"`
+	Delivery      *models.WebhookDelivery   `json:"webhook_delivery,omitempty"`
+}
+
+// Record - запись журнала: одна операция Library со всеми её изменениями.
+type Record struct {
+	Seq     uint64    `json:"seq"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Changes []Change  `json:"changes"`
+}
+
+func (s *Snapshot) apply(rec Record) error {
+	for _, c := range rec.Changes {
+		switch c.Op {
+		case ChangeSaveBook:
+			putRow(&s.Books, bookID, &s.NextIDBook, c.Book)
+		case ChangeDeleteBook:
+			deleteRow(&s.Books, bookID, c.ID)
+		case ChangeSaveCopy:
+			putRow(&s.Copies, copyID, &s.NextIDCopy, c.Copy)
+		case ChangeDeleteCopy:
+			deleteRow(&s.Copies, copyID, c.ID)
+		case ChangeSaveAuthor:
+			putRow(&s.Authors, authorID, &s.NextIDAuthor, c.Author)
+		case ChangeSaveReservation:
+			putRow(&s.Reservations, reservationID, &s.NextIDReservation, c.Reservation)
+		case ChangeDeleteReservation:
+			deleteRow(&s.Reservations, reservationID, c.ID)
+		case ChangeSaveLoan:
+			putRow(&s.Loans, loanID, &s.NextIDLoan, c.Loan)
+		case ChangeSaveWaitlistEntry:
+			putRow(&s.Waitlist, waitlistID, &s.NextIDWaitlist, c.WaitlistEntry)
+		case ChangeSaveFine:
+			putRow(&s.Fines, fineID, &s.NextIDFine, c.Fine)
+		case ChangeAddLedgerEntry:
+			putRow(&s.Ledger, ledgerID, &s.NextIDLedger, c.LedgerEntry)
+		case ChangeSavePatron:
+			putRow(&s.Patrons, patronID, &s.NextIDPatron, c.Patron)
+		case ChangeSaveAccount:
+			putRow(&s.Accounts, accountID, &s.NextIDAccount, c.Account)
+		case ChangeSaveAPIKey:
+			putRow(&s.APIKeys, apiKeyID, &s.NextIDAPIKey, c.APIKey)
+		case ChangeSaveNotification:
+			putRow(&s.Notifications, notificationID, &s.NextIDNotification, c.Notification)
+		case ChangeSaveWebhook:
+			putRow(&s.Webhooks, webhookID, &s.NextIDWebhook, c.Webhook)
+		case ChangeDeleteWebhook:
+			deleteWebhook(s, c.ID)
+		case ChangeSaveDelivery:
+			putRow(&s.WebhookDeliveries, deliveryID, &s.NextIDDelivery, c.Delivery)
+		default:
+			return fmt.Errorf("запись журнала #%d: неизвестное изменение %q", rec.Seq, c.Op)
+		}
+	}
+	s.JournalSeq = rec.Seq
+	return nil
+}
+
+// JournalStore пишет каждую операцию в журнал (write-ahead log) и делает
+// fsync до того, как изменения станут видны. Снимок в формате library.json
+// обновляется только при сжатии журнала.
+type JournalStore struct {
+	*MemoryStore
+	snapshotPath string
+	journalPath  string
+	file         *os.File
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewJournalStore(snapshotPath, journalPath string) (*JournalStore, error) {
+	snapshot, err := LoadSnapshot(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed, err := replayJournal(journalPath, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if replayed > 0 {
+		fmt.Printf("Из журнала восстановлено операций: %d\n", replayed)
+	}
+
+	file, err := os.OpenFile(journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось открыть журнал %s: %w", journalPath, err)
+	}
+
+	store := &JournalStore{
+		MemoryStore:  NewMemoryStoreFrom(snapshot),
+		snapshotPath: snapshotPath,
+		journalPath:  journalPath,
+		file:         file,
+		stop:         make(chan struct{}),
+	}
+	store.commit = store.append
+	return store, nil
+}
+
+// replayJournal применяет к снимку записи, которых в нём ещё нет.
+// Недописанная последняя запись (обрыв при падении) отбрасывается,
+// а файл обрезается до последней целой записи.
+func replayJournal(path string, snapshot *Snapshot) (int, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("не удалось открыть журнал %s: %w", path, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	replayed := 0
+
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && readErr == io.EOF {
+			break
+		}
+		if readErr != nil && readErr != io.EOF {
+			return replayed, readErr
+		}
+
+		var rec Record
+		complete := readErr == nil
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil || !complete {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				fmt.Printf("Журнал %s: отброшена недописанная запись (%d байт)\n", path, len(line))
+				if err := file.Truncate(offset); err != nil {
+					return replayed, err
+				}
+				return replayed, file.Sync()
+			}
+			return replayed, fmt.Errorf("журнал %s повреждён на смещении %d", path, offset)
+		}
+		offset += int64(len(line))
+
+		if rec.Seq <= snapshot.JournalSeq {
+			continue
+		}
+		if err := snapshot.apply(rec); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+	return replayed, nil
+}
+
+func (j *JournalStore) append(op string, tx *snapshotTx) error {
+	if len(tx.changes) == 0 {
+		return nil
+	}
+
+	rec := Record{
+		Seq:     j.state.JournalSeq + 1,
+		Type:    op,
+		Time:    time.Now(),
+		Changes: tx.changes,
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("%s: не удалось записать журнал: %w", op, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("%s: не удалось сбросить журнал на диск: %w", op, err)
+	}
+
+	tx.s.JournalSeq = rec.Seq
+	return nil
+}
+
+// Compact записывает свежий снимок и очищает журнал.
+func (j *JournalStore) Compact() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := WriteSnapshot(j.snapshotPath, j.state); err != nil {
+		return fmt.Errorf("не удалось записать снимок: %w", err)
+	}
+	// Если упадём здесь, записи журнала с Seq <= JournalSeq снимка
+	// будут пропущены при следующем запуске.
+	if err := j.file.Truncate(0); err != nil {
+		return fmt.Errorf("не удалось очистить журнал: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// StartCompaction периодически сжимает журнал до вызова Close.
+func (j *JournalStore) StartCompaction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.Compact(); err != nil {
+					fmt.Printf("Ошибка сжатия журнала: %v\n", err)
+				}
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (j *JournalStore) Close() error {
+	j.stopOnce.Do(func() { close(j.stop) })
+
+	err := j.Compact()
+	if closeErr := j.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
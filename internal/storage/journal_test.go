@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"bytes"
+	"library-app/internal/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openJournal(t *testing.T, dir string) *JournalStore {
+	t.Helper()
+	store, err := NewJournalStore(filepath.Join(dir, "library.json"), filepath.Join(dir, "journal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// crash закрывает журнал без сжатия, как при падении процесса.
+func crash(t *testing.T, store *JournalStore) {
+	t.Helper()
+	if err := store.file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addAuthors(t *testing.T, store *JournalStore, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		err := store.Update("AddAuthor", func(tx Tx) error {
+			return tx.SaveAuthor(&models.Author{Person: models.Person{Name: name}})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func authorNames(t *testing.T, store *JournalStore) []string {
+	t.Helper()
+	authors, err := store.Authors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range authors {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+func checkAuthors(t *testing.T, store *JournalStore, want ...string) {
+	t.Helper()
+	got := authorNames(t, store)
+	if len(got) != len(want) {
+		t.Fatalf("авторы %v, ожидалось %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("авторы %v, ожидалось %v", got, want)
+		}
+	}
+}
+
+func TestJournalTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.log")
+
+	store := openJournal(t, dir)
+	addAuthors(t, store, "Толстой", "Достоевский", "Чехов")
+	crash(t, store)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	complete := len(lines[0]) + len(lines[1])
+	// Обрыв посреди третьей записи
+	if err := os.Truncate(path, int64(complete+len(lines[2])/2)); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openJournal(t, dir)
+	checkAuthors(t, store, "Толстой", "Достоевский")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(complete) {
+		t.Fatalf("журнал не обрезан до последней целой записи: %d байт, ожидалось %d", info.Size(), complete)
+	}
+
+	// После обрезки журнал снова пишется и читается целиком
+	addAuthors(t, store, "Гоголь")
+	crash(t, store)
+	store = openJournal(t, dir)
+	checkAuthors(t, store, "Толстой", "Достоевский", "Гоголь")
+	crash(t, store)
+}
+
+func TestJournalDamagedMiddleRecord(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.log")
+
+	store := openJournal(t, dir)
+	addAuthors(t, store, "Толстой", "Достоевский")
+	crash(t, store)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Испорчена не последняя запись - это не обрыв, молча терять
+	// операции после неё нельзя
+	data[1] = '#'
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJournalStore(filepath.Join(dir, "library.json"), path); err == nil {
+		t.Fatal("повреждённый журнал открыт без ошибки")
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "journal.log")
+
+	store := openJournal(t, dir)
+	addAuthors(t, store, "Толстой", "Достоевский")
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Fatalf("журнал не очищен после сжатия: %d байт", info.Size())
+	}
+
+	addAuthors(t, store, "Чехов")
+	crash(t, store)
+
+	store = openJournal(t, dir)
+	checkAuthors(t, store, "Толстой", "Достоевский", "Чехов")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Падение между записью снимка и очисткой журнала: записи, которые
+	// уже есть в снимке, не применяются второй раз
+	if err := os.WriteFile(path, before, 0644); err != nil {
+		t.Fatal(err)
+	}
+	store = openJournal(t, dir)
+	checkAuthors(t, store, "Толстой", "Достоевский", "Чехов")
+	crash(t, store)
+}
@@ -0,0 +1,29 @@
+package storage
+
+import "fmt"
+
+// JSONFileStore держит состояние в памяти и после каждого Update атомарно
+// перезаписывает файл в формате library.json.
+type JSONFileStore struct {
+	*MemoryStore
+	path string
+}
+
+func NewJSONFileStore(path string) (*JSONFileStore, error) {
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &JSONFileStore{
+		MemoryStore: NewMemoryStoreFrom(snapshot),
+		path:        path,
+	}
+	store.commit = func(op string, tx *snapshotTx) error {
+		if err := WriteSnapshot(store.path, tx.s); err != nil {
+			return fmt.Errorf("%s: не удалось сохранить %s: %w", op, store.path, err)
+		}
+		return nil
+	}
+	return store, nil
+}
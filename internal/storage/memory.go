@@ -0,0 +1,566 @@
+package storage
+
+import (
+	"library-app/internal/models"
+	"slices"
+	"sync"
+)
+
+// MemoryStore хранит состояние в памяти. Его же используют файловые
+// хранилища, подставляя свой commit.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	state  *Snapshot
+	commit func(op string, tx *snapshotTx) error
+}
+
+func NewMemoryStore() *MemoryStore {
+	return NewMemoryStoreFrom(NewSnapshot())
+}
+
+func NewMemoryStoreFrom(s *Snapshot) *MemoryStore {
+	s.normalize()
+	return &MemoryStore{state: s}
+}
+
+func (m *MemoryStore) Update(op string, fn func(tx Tx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &snapshotTx{s: m.state.Clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if m.commit != nil {
+		if err := m.commit(op, tx); err != nil {
+			return err
+		}
+	}
+	m.state = tx.s
+	return nil
+}
+
+// Snapshot возвращает копию текущего состояния.
+func (m *MemoryStore) Snapshot() *Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.Clone()
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) read() *snapshotTx {
+	return &snapshotTx{s: m.state}
+}
+
+func (m *MemoryStore) Books() ([]*models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Books()
+}
+
+func (m *MemoryStore) Book(id int) (*models.Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Book(id)
+}
+
+func (m *MemoryStore) Copies() ([]*models.Copy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Copies()
+}
+
+func (m *MemoryStore) Copy(id int) (*models.Copy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Copy(id)
+}
+
+func (m *MemoryStore) Authors() ([]*models.Author, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Authors()
+}
+
+func (m *MemoryStore) Author(id int) (*models.Author, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Author(id)
+}
+
+func (m *MemoryStore) Reservations() ([]*models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Reservations()
+}
+
+func (m *MemoryStore) Reservation(id int) (*models.Reservation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Reservation(id)
+}
+
+func (m *MemoryStore) Loans() ([]*models.Loan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Loans()
+}
+
+func (m *MemoryStore) Loan(id int) (*models.Loan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Loan(id)
+}
+
+func (m *MemoryStore) Waitlist() ([]*models.WaitlistEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Waitlist()
+}
+
+func (m *MemoryStore) Fines() ([]*models.Fine, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Fines()
+}
+
+func (m *MemoryStore) Fine(id int) (*models.Fine, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Fine(id)
+}
+
+func (m *MemoryStore) Ledger() ([]*models.LedgerEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Ledger()
+}
+
+func (m *MemoryStore) Patrons() ([]*models.Patron, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Patrons()
+}
+
+func (m *MemoryStore) Patron(id int) (*models.Patron, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Patron(id)
+}
+
+func (m *MemoryStore) Accounts() ([]*models.Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Accounts()
+}
+
+func (m *MemoryStore) APIKeys() ([]*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().APIKeys()
+}
+
+func (m *MemoryStore) APIKey(id int) (*models.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().APIKey(id)
+}
+
+func (m *MemoryStore) Notifications() ([]*models.EmailNotification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Notifications()
+}
+
+func (m *MemoryStore) Notification(id int) (*models.EmailNotification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Notification(id)
+}
+
+func (m *MemoryStore) Webhooks() ([]*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Webhooks()
+}
+
+func (m *MemoryStore) Webhook(id int) (*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().Webhook(id)
+}
+
+func (m *MemoryStore) WebhookDeliveries() ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().WebhookDeliveries()
+}
+
+func (m *MemoryStore) WebhookDelivery(id int) (*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.read().WebhookDelivery(id)
+}
+
+// snapshotTx работает напрямую со снимком без блокировок:
+// внутри Update снимок принадлежит только ему.
+type snapshotTx struct {
+	s       *Snapshot
+	changes []Change
+}
+
+func bookID(b *models.Book) *int                      { return &b.ID }
+func copyID(c *models.Copy) *int                      { return &c.ID }
+func authorID(a *models.Author) *int                  { return &a.AuthorID }
+func reservationID(r *models.Reservation) *int        { return &r.ID }
+func loanID(l *models.Loan) *int                      { return &l.ID }
+func waitlistID(e *models.WaitlistEntry) *int         { return &e.ID }
+func fineID(f *models.Fine) *int                      { return &f.ID }
+func ledgerID(e *models.LedgerEntry) *int             { return &e.ID }
+func patronID(p *models.Patron) *int                  { return &p.ID }
+func accountID(a *models.Account) *int                { return &a.ID }
+func apiKeyID(k *models.APIKey) *int                  { return &k.ID }
+func notificationID(n *models.EmailNotification) *int { return &n.ID }
+func webhookID(w *models.Webhook) *int                { return &w.ID }
+func deliveryID(d *models.WebhookDelivery) *int       { return &d.ID }
+
+func (tx *snapshotTx) Books() ([]*models.Book, error) {
+	return copyRows(tx.s.Books), nil
+}
+
+func (tx *snapshotTx) Book(id int) (*models.Book, error) {
+	return findRow(tx.s.Books, bookID, id)
+}
+
+func (tx *snapshotTx) SaveBook(book *models.Book) error {
+	if err := saveRow(&tx.s.Books, bookID, &tx.s.NextIDBook, book); err != nil {
+		return err
+	}
+	b := *book
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveBook, Book: &b})
+	return nil
+}
+
+func (tx *snapshotTx) DeleteBook(id int) error {
+	if err := deleteRow(&tx.s.Books, bookID, id); err != nil {
+		return err
+	}
+	tx.changes = append(tx.changes, Change{Op: ChangeDeleteBook, ID: id})
+	return nil
+}
+
+func (tx *snapshotTx) Copies() ([]*models.Copy, error) {
+	return copyRows(tx.s.Copies), nil
+}
+
+func (tx *snapshotTx) Copy(id int) (*models.Copy, error) {
+	return findRow(tx.s.Copies, copyID, id)
+}
+
+func (tx *snapshotTx) SaveCopy(c *models.Copy) error {
+	if err := saveRow(&tx.s.Copies, copyID, &tx.s.NextIDCopy, c); err != nil {
+		return err
+	}
+	saved := *c
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveCopy, Copy: &saved})
+	return nil
+}
+
+func (tx *snapshotTx) DeleteCopy(id int) error {
+	if err := deleteRow(&tx.s.Copies, copyID, id); err != nil {
+		return err
+	}
+	tx.changes = append(tx.changes, Change{Op: ChangeDeleteCopy, ID: id})
+	return nil
+}
+
+func (tx *snapshotTx) Authors() ([]*models.Author, error) {
+	return copyRows(tx.s.Authors), nil
+}
+
+func (tx *snapshotTx) Author(id int) (*models.Author, error) {
+	return findRow(tx.s.Authors, authorID, id)
+}
+
+func (tx *snapshotTx) SaveAuthor(author *models.Author) error {
+	if err := saveRow(&tx.s.Authors, authorID, &tx.s.NextIDAuthor, author); err != nil {
+		return err
+	}
+	a := *author
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveAuthor, Author: &a})
+	return nil
+}
+
+func (tx *snapshotTx) Reservations() ([]*models.Reservation, error) {
+	return copyRows(tx.s.Reservations), nil
+}
+
+func (tx *snapshotTx) Reservation(id int) (*models.Reservation, error) {
+	return findRow(tx.s.Reservations, reservationID, id)
+}
+
+func (tx *snapshotTx) SaveReservation(reservation *models.Reservation) error {
+	if err := saveRow(&tx.s.Reservations, reservationID, &tx.s.NextIDReservation, reservation); err != nil {
+		return err
+	}
+	r := *reservation
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveReservation, Reservation: &r})
+	return nil
+}
+
+func (tx *snapshotTx) DeleteReservation(id int) error {
+	if err := deleteRow(&tx.s.Reservations, reservationID, id); err != nil {
+		return err
+	}
+	tx.changes = append(tx.changes, Change{Op: ChangeDeleteReservation, ID: id})
+	return nil
+}
+
+func (tx *snapshotTx) Loans() ([]*models.Loan, error) {
+	return copyRows(tx.s.Loans), nil
+}
+
+func (tx *snapshotTx) Loan(id int) (*models.Loan, error) {
+	return findRow(tx.s.Loans, loanID, id)
+}
+
+func (tx *snapshotTx) SaveLoan(loan *models.Loan) error {
+	if err := saveRow(&tx.s.Loans, loanID, &tx.s.NextIDLoan, loan); err != nil {
+		return err
+	}
+	l := *loan
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveLoan, Loan: &l})
+	return nil
+}
+
+func (tx *snapshotTx) Waitlist() ([]*models.WaitlistEntry, error) {
+	return copyRows(tx.s.Waitlist), nil
+}
+
+func (tx *snapshotTx) SaveWaitlistEntry(entry *models.WaitlistEntry) error {
+	if err := saveRow(&tx.s.Waitlist, waitlistID, &tx.s.NextIDWaitlist, entry); err != nil {
+		return err
+	}
+	e := *entry
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveWaitlistEntry, WaitlistEntry: &e})
+	return nil
+}
+
+func (tx *snapshotTx) Fines() ([]*models.Fine, error) {
+	return copyRows(tx.s.Fines), nil
+}
+
+func (tx *snapshotTx) Fine(id int) (*models.Fine, error) {
+	return findRow(tx.s.Fines, fineID, id)
+}
+
+func (tx *snapshotTx) SaveFine(fine *models.Fine) error {
+	if err := saveRow(&tx.s.Fines, fineID, &tx.s.NextIDFine, fine); err != nil {
+		return err
+	}
+	f := *fine
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveFine, Fine: &f})
+	return nil
+}
+
+func (tx *snapshotTx) Ledger() ([]*models.LedgerEntry, error) {
+	return copyRows(tx.s.Ledger), nil
+}
+
+func (tx *snapshotTx) AddLedgerEntry(entry *models.LedgerEntry) error {
+	entry.ID = 0
+	if err := saveRow(&tx.s.Ledger, ledgerID, &tx.s.NextIDLedger, entry); err != nil {
+		return err
+	}
+	e := *entry
+	tx.changes = append(tx.changes, Change{Op: ChangeAddLedgerEntry, LedgerEntry: &e})
+	return nil
+}
+
+func (tx *snapshotTx) Patrons() ([]*models.Patron, error) {
+	return copyRows(tx.s.Patrons), nil
+}
+
+func (tx *snapshotTx) Patron(id int) (*models.Patron, error) {
+	return findRow(tx.s.Patrons, patronID, id)
+}
+
+func (tx *snapshotTx) SavePatron(patron *models.Patron) error {
+	if err := saveRow(&tx.s.Patrons, patronID, &tx.s.NextIDPatron, patron); err != nil {
+		return err
+	}
+	p := *patron
+	tx.changes = append(tx.changes, Change{Op: ChangeSavePatron, Patron: &p})
+	return nil
+}
+
+func (tx *snapshotTx) Accounts() ([]*models.Account, error) {
+	return copyRows(tx.s.Accounts), nil
+}
+
+func (tx *snapshotTx) SaveAccount(account *models.Account) error {
+	if err := saveRow(&tx.s.Accounts, accountID, &tx.s.NextIDAccount, account); err != nil {
+		return err
+	}
+	a := *account
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveAccount, Account: &a})
+	return nil
+}
+
+func (tx *snapshotTx) APIKeys() ([]*models.APIKey, error) {
+	return copyRows(tx.s.APIKeys), nil
+}
+
+func (tx *snapshotTx) APIKey(id int) (*models.APIKey, error) {
+	return findRow(tx.s.APIKeys, apiKeyID, id)
+}
+
+func (tx *snapshotTx) SaveAPIKey(key *models.APIKey) error {
+	if err := saveRow(&tx.s.APIKeys, apiKeyID, &tx.s.NextIDAPIKey, key); err != nil {
+		return err
+	}
+	k := *key
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveAPIKey, APIKey: &k})
+	return nil
+}
+
+func (tx *snapshotTx) Notifications() ([]*models.EmailNotification, error) {
+	return copyRows(tx.s.Notifications), nil
+}
+
+func (tx *snapshotTx) Notification(id int) (*models.EmailNotification, error) {
+	return findRow(tx.s.Notifications, notificationID, id)
+}
+
+func (tx *snapshotTx) SaveNotification(notification *models.EmailNotification) error {
+	if err := saveRow(&tx.s.Notifications, notificationID, &tx.s.NextIDNotification, notification); err != nil {
+		return err
+	}
+	n := *notification
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveNotification, Notification: &n})
+	return nil
+}
+
+func (tx *snapshotTx) Webhooks() ([]*models.Webhook, error) {
+	return copyRows(tx.s.Webhooks), nil
+}
+
+func (tx *snapshotTx) Webhook(id int) (*models.Webhook, error) {
+	return findRow(tx.s.Webhooks, webhookID, id)
+}
+
+func (tx *snapshotTx) SaveWebhook(webhook *models.Webhook) error {
+	if err := saveRow(&tx.s.Webhooks, webhookID, &tx.s.NextIDWebhook, webhook); err != nil {
+		return err
+	}
+	w := *webhook
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveWebhook, Webhook: &w})
+	return nil
+}
+
+func (tx *snapshotTx) DeleteWebhook(id int) error {
+	if err := deleteWebhook(tx.s, id); err != nil {
+		return err
+	}
+	tx.changes = append(tx.changes, Change{Op: ChangeDeleteWebhook, ID: id})
+	return nil
+}
+
+func (tx *snapshotTx) WebhookDeliveries() ([]*models.WebhookDelivery, error) {
+	return copyRows(tx.s.WebhookDeliveries), nil
+}
+
+func (tx *snapshotTx) WebhookDelivery(id int) (*models.WebhookDelivery, error) {
+	return findRow(tx.s.WebhookDeliveries, deliveryID, id)
+}
+
+func (tx *snapshotTx) SaveWebhookDelivery(delivery *models.WebhookDelivery) error {
+	if err := saveRow(&tx.s.WebhookDeliveries, deliveryID, &tx.s.NextIDDelivery, delivery); err != nil {
+		return err
+	}
+	d := *delivery
+	tx.changes = append(tx.changes, Change{Op: ChangeSaveDelivery, Delivery: &d})
+	return nil
+}
+
+// deleteWebhook удаляет подписку и её доставки, как ON DELETE CASCADE в SQL.
+func deleteWebhook(s *Snapshot, id int) error {
+	if err := deleteRow(&s.Webhooks, webhookID, id); err != nil {
+		return err
+	}
+	s.WebhookDeliveries = slices.DeleteFunc(s.WebhookDeliveries, func(d *models.WebhookDelivery) bool {
+		return d.WebhookID == id
+	})
+	return nil
+}
+
+func copyRows[T any](rows []*T) []*T {
+	out := make([]*T, len(rows))
+	for i, row := range rows {
+		v := *row
+		out[i] = &v
+	}
+	return out
+}
+
+func findRow[T any](rows []*T, idOf func(*T) *int, id int) (*T, error) {
+	for _, row := range rows {
+		if *idOf(row) == id {
+			v := *row
+			return &v, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// saveRow вставляет строку с новым ID, если ID нулевой, иначе заменяет
+// существующую.
+func saveRow[T any](rows *[]*T, idOf func(*T) *int, nextID *int, row *T) error {
+	if *idOf(row) == 0 {
+		*idOf(row) = *nextID
+		*nextID++
+		v := *row
+		*rows = append(*rows, &v)
+		return nil
+	}
+	for i, existing := range *rows {
+		if *idOf(existing) == *idOf(row) {
+			v := *row
+			(*rows)[i] = &v
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// putRow вставляет или заменяет строку с уже известным ID и сдвигает
+// счётчик, чтобы новые ID не пересеклись с ней. Используется при
+// воспроизведении журнала.
+func putRow[T any](rows *[]*T, idOf func(*T) *int, nextID *int, row *T) {
+	v := *row
+	id := *idOf(&v)
+	if id >= *nextID {
+		*nextID = id + 1
+	}
+	for i, existing := range *rows {
+		if *idOf(existing) == id {
+			(*rows)[i] = &v
+			return
+		}
+	}
+	*rows = append(*rows, &v)
+}
+
+func deleteRow[T any](rows *[]*T, idOf func(*T) *int, id int) error {
+	for i, row := range *rows {
+		if *idOf(row) == id {
+			*rows = append((*rows)[:i], (*rows)[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,34 @@
+CREATE TABLE authors (
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    name      TEXT    NOT NULL,
+    email     TEXT    NOT NULL,
+    biography TEXT    NOT NULL DEFAULT ''
+);
+
+CREATE TABLE books (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    title        TEXT    NOT NULL,
+    author_id    INTEGER NOT NULL REFERENCES authors (id),
+    year         INTEGER NOT NULL,
+    is_available INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TABLE reservations (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id    INTEGER   NOT NULL,
+    user_email TEXT      NOT NULL,
+    start_date TIMESTAMP NOT NULL,
+    end_date   TIMESTAMP NOT NULL,
+    status     TEXT      NOT NULL
+);
+
+CREATE INDEX reservations_user_email ON reservations (user_email, status);
+
+CREATE TABLE notifications (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    to_email   TEXT      NOT NULL,
+    subject    TEXT      NOT NULL,
+    message    TEXT      NOT NULL,
+    status     TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,23 @@
+CREATE TABLE copies (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id  INTEGER NOT NULL REFERENCES books (id),
+    barcode  TEXT    NOT NULL UNIQUE,
+    branch   TEXT    NOT NULL DEFAULT '',
+    location TEXT    NOT NULL DEFAULT '',
+    status   TEXT    NOT NULL
+);
+
+CREATE INDEX copies_book_id ON copies (book_id);
+
+-- Для уже существующих книг заводим по одному экземпляру
+INSERT INTO copies (book_id, barcode, status)
+SELECT id,
+       printf('LIB-%05d-01', id),
+       CASE WHEN is_available THEN 'available' ELSE 'reserved' END
+FROM books;
+
+ALTER TABLE reservations ADD COLUMN copy_id INTEGER NOT NULL DEFAULT 0;
+
+UPDATE reservations
+SET copy_id = (SELECT c.id FROM copies c WHERE c.book_id = reservations.book_id)
+WHERE status = 'active';
@@ -0,0 +1,13 @@
+CREATE TABLE loans (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id        INTEGER   NOT NULL,
+    copy_id        INTEGER   NOT NULL,
+    reservation_id INTEGER   NOT NULL DEFAULT 0,
+    user_email     TEXT      NOT NULL,
+    checkout_date  TIMESTAMP NOT NULL,
+    due_date       TIMESTAMP NOT NULL,
+    return_date    TIMESTAMP,
+    status         TEXT      NOT NULL
+);
+
+CREATE INDEX loans_user_email ON loans (user_email, status);
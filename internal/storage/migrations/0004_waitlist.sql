@@ -0,0 +1,10 @@
+CREATE TABLE waitlist (
+    id             INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id        INTEGER   NOT NULL,
+    user_email     TEXT      NOT NULL,
+    created_at     TIMESTAMP NOT NULL,
+    status         TEXT      NOT NULL,
+    reservation_id INTEGER   NOT NULL DEFAULT 0
+);
+
+CREATE INDEX waitlist_book_id ON waitlist (book_id, status);
@@ -0,0 +1,3 @@
+ALTER TABLE reservations ADD COLUMN renewals INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE loans ADD COLUMN renewals INTEGER NOT NULL DEFAULT 0;
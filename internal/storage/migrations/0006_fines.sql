@@ -0,0 +1,26 @@
+-- Суммы хранятся в копейках
+CREATE TABLE fines (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    loan_id    INTEGER   NOT NULL UNIQUE,
+    user_email TEXT      NOT NULL,
+    amount     INTEGER   NOT NULL DEFAULT 0,
+    paid       INTEGER   NOT NULL DEFAULT 0,
+    waived     INTEGER   NOT NULL DEFAULT 0,
+    status     TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX fines_user_email ON fines (user_email);
+
+CREATE TABLE ledger (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    fine_id    INTEGER   NOT NULL REFERENCES fines (id),
+    user_email TEXT      NOT NULL,
+    type       TEXT      NOT NULL,
+    amount     INTEGER   NOT NULL,
+    note       TEXT      NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX ledger_user_email ON ledger (user_email);
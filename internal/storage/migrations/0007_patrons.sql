@@ -0,0 +1,11 @@
+CREATE TABLE patrons (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    name          TEXT      NOT NULL,
+    email         TEXT      NOT NULL UNIQUE,
+    card_number   TEXT      NOT NULL,
+    phone         TEXT      NOT NULL DEFAULT '',
+    address       TEXT      NOT NULL DEFAULT '',
+    status        TEXT      NOT NULL,
+    registered_at TIMESTAMP NOT NULL,
+    expires_at    TIMESTAMP NOT NULL
+);
@@ -0,0 +1,2 @@
+ALTER TABLE patrons ADD COLUMN category TEXT NOT NULL DEFAULT 'standard';
+ALTER TABLE copies ADD COLUMN item_type TEXT NOT NULL DEFAULT 'book';
@@ -0,0 +1,12 @@
+-- scopes - права через запятую
+CREATE TABLE api_keys (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    name         TEXT      NOT NULL,
+    prefix       TEXT      NOT NULL UNIQUE,
+    key_hash     TEXT      NOT NULL,
+    scopes       TEXT      NOT NULL,
+    created_by   TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL,
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
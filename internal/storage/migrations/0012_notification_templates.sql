@@ -0,0 +1,2 @@
+ALTER TABLE patrons ADD COLUMN language TEXT NOT NULL DEFAULT 'ru';
+ALTER TABLE notifications ADD COLUMN html TEXT NOT NULL DEFAULT '';
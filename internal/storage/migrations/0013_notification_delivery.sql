@@ -0,0 +1,4 @@
+ALTER TABLE notifications ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE notifications ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE notifications ADD COLUMN next_attempt_at TIMESTAMP;
+ALTER TABLE notifications ADD COLUMN sent_at TIMESTAMP;
@@ -0,0 +1,5 @@
+ALTER TABLE patrons ADD COLUMN notify_muted TEXT NOT NULL DEFAULT '';
+ALTER TABLE patrons ADD COLUMN notify_channel TEXT NOT NULL DEFAULT 'email';
+ALTER TABLE patrons ADD COLUMN quiet_start TEXT NOT NULL DEFAULT '';
+ALTER TABLE patrons ADD COLUMN quiet_end TEXT NOT NULL DEFAULT '';
+ALTER TABLE loans ADD COLUMN reminded_at TIMESTAMP;
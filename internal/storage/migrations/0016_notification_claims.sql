@@ -0,0 +1,2 @@
+-- queued_at - когда письмо забрано в очередь в памяти одной из реплик
+ALTER TABLE notifications ADD COLUMN queued_at TIMESTAMP;
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"errors"
+	"library-app/internal/models"
+)
+
+var (
+	ErrNotFound = errors.New("запись не найдена")
+	// ErrConflict - запись изменили параллельно (например, другая реплика API).
+	ErrConflict = errors.New("запись изменена параллельно")
+)
+
+// Reader - операции чтения, доступные как вне, так и внутри транзакции.
+type Reader interface {
+	Books() ([]*models.Book, error)
+	Book(id int) (*models.Book, error)
+	Copies() ([]*models.Copy, error)
+	Copy(id int) (*models.Copy, error)
+	Authors() ([]*models.Author, error)
+	Author(id int) (*models.Author, error)
+	Reservations() ([]*models.Reservation, error)
+	Reservation(id int) (*models.Reservation, error)
+	Loans() ([]*models.Loan, error)
+	Loan(id int) (*models.Loan, error)
+	Waitlist() ([]*models.WaitlistEntry, error)
+	Fines() ([]*models.Fine, error)
+	Fine(id int) (*models.Fine, error)
+	Ledger() ([]*models.LedgerEntry, error)
+	Patrons() ([]*models.Patron, error)
+	Patron(id int) (*models.Patron, error)
+	Accounts() ([]*models.Account, error)
+	APIKeys() ([]*models.APIKey, error)
+	APIKey(id int) (*models.APIKey, error)
+	Notifications() ([]*models.EmailNotification, error)
+	Notification(id int) (*models.EmailNotification, error)
+	Webhooks() ([]*models.Webhook, error)
+	Webhook(id int) (*models.Webhook, error)
+	WebhookDeliveries() ([]*models.WebhookDelivery, error)
+	WebhookDelivery(id int) (*models.WebhookDelivery, error)
+}
+
+// Tx - изменения, выполняемые внутри Repository.Update.
+// Save* с нулевым ID создаёт запись и проставляет ей новый ID,
+// с ненулевым - обновляет существующую (ErrNotFound, если её нет).
+type Tx interface {
+	Reader
+	SaveBook(book *models.Book) error
+	DeleteBook(id int) error
+	SaveCopy(c *models.Copy) error
+	DeleteCopy(id int) error
+	SaveAuthor(author *models.Author) error
+	SaveReservation(reservation *models.Reservation) error
+	DeleteReservation(id int) error
+	SaveLoan(loan *models.Loan) error
+	SaveWaitlistEntry(entry *models.WaitlistEntry) error
+	SaveFine(fine *models.Fine) error
+	// AddLedgerEntry только добавляет запись: журнал расчётов не меняется.
+	AddLedgerEntry(entry *models.LedgerEntry) error
+	SavePatron(patron *models.Patron) error
+	SaveAccount(account *models.Account) error
+	SaveAPIKey(key *models.APIKey) error
+	SaveNotification(notification *models.EmailNotification) error
+	SaveWebhook(webhook *models.Webhook) error
+	// DeleteWebhook удаляет подписку вместе с журналом её доставок
+	DeleteWebhook(id int) error
+	SaveWebhookDelivery(delivery *models.WebhookDelivery) error
+}
+
+type Repository interface {
+	Reader
+	// Update выполняет fn как одну атомарную операцию op: если fn вернула
+	// ошибку, ни одно изменение не сохраняется.
+	Update(op string, fn func(tx Tx) error) error
+	Close() error
+}
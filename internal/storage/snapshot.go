@@ -0,0 +1,337 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"library-app/internal/models"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot - полное состояние библиотеки в формате library.json.
+type Snapshot struct {
+	Books              []*models.Book              `json:"Books"`
+	Copies             []*models.Copy              `json:"Copies"`
+	Authors            []*models.Author            `json:"Authors"`
+	Reservations       []*models.Reservation       `json:"Reservations"`
+	Loans              []*models.Loan              `json:"Loans"`
+	Waitlist           []*models.WaitlistEntry     `json:"Waitlist"`
+	Fines              []*models.Fine              `json:"Fines"`
+	Ledger             []*models.LedgerEntry       `json:"Ledger"`
+	Patrons            []*models.Patron            `json:"Patrons"`
+	Accounts           []*models.Account           `json:"Accounts"`
+	APIKeys            []*models.APIKey            `json:"APIKeys"`
+	Notifications      []*models.EmailNotification `json:"Notifications"`
+	Webhooks           []*models.Webhook           `json:"Webhooks"`
+	WebhookDeliveries  []*models.WebhookDelivery   `json:"WebhookDeliveries"`
+	NextIDBook         int                         `json:"NextIDBook"`
+	NextIDCopy         int                         `json:"NextIDCopy"`
+	NextIDAuthor       int                         `json:"NextIDAuthor"`
+	NextIDReservation  int                         `json:"NextIDReservation"`
+	NextIDLoan         int                         `json:"NextIDLoan"`
+	NextIDWaitlist     int                         `json:"NextIDWaitlist"`
+	NextIDFine         int                         `json:"NextIDFine"`
+	NextIDLedger       int                         `json:"NextIDLedger"`
+	NextIDPatron       int                         `json:"NextIDPatron"`
+	NextIDAccount      int                         `json:"NextIDAccount"`
+	NextIDAPIKey       int                         `json:"NextIDAPIKey"`
+	NextIDNotification int                         `json:"NextIDNotification"`
+	NextIDWebhook      int                         `json:"NextIDWebhook"`
+	NextIDDelivery     int                         `json:"NextIDDelivery"`
+	// JournalSeq - номер последней записи журнала, уже вошедшей в снимок.
+	JournalSeq uint64 `json:"JournalSeq,omitempty"`
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		Books:              []*models.Book{},
+		Copies:             []*models.Copy{},
+		Authors:            []*models.Author{},
+		Reservations:       []*models.Reservation{},
+		Loans:              []*models.Loan{},
+		Waitlist:           []*models.WaitlistEntry{},
+		Fines:              []*models.Fine{},
+		Ledger:             []*models.LedgerEntry{},
+		Patrons:            []*models.Patron{},
+		Accounts:           []*models.Account{},
+		APIKeys:            []*models.APIKey{},
+		Notifications:      []*models.EmailNotification{},
+		Webhooks:           []*models.Webhook{},
+		WebhookDeliveries:  []*models.WebhookDelivery{},
+		NextIDBook:         1,
+		NextIDCopy:         1,
+		NextIDAuthor:       1,
+		NextIDReservation:  1,
+		NextIDLoan:         1,
+		NextIDWaitlist:     1,
+		NextIDFine:         1,
+		NextIDLedger:       1,
+		NextIDPatron:       1,
+		NextIDAccount:      1,
+		NextIDAPIKey:       1,
+		NextIDNotification: 1,
+		NextIDWebhook:      1,
+		NextIDDelivery:     1,
+	}
+}
+
+func (s *Snapshot) Clone() *Snapshot {
+	return &Snapshot{
+		Books:              copyRows(s.Books),
+		Copies:             copyRows(s.Copies),
+		Authors:            copyRows(s.Authors),
+		Reservations:       copyRows(s.Reservations),
+		Loans:              copyRows(s.Loans),
+		Waitlist:           copyRows(s.Waitlist),
+		Fines:              copyRows(s.Fines),
+		Ledger:             copyRows(s.Ledger),
+		Patrons:            copyRows(s.Patrons),
+		Accounts:           copyRows(s.Accounts),
+		APIKeys:            copyRows(s.APIKeys),
+		Notifications:      copyRows(s.Notifications),
+		Webhooks:           copyRows(s.Webhooks),
+		WebhookDeliveries:  copyRows(s.WebhookDeliveries),
+		NextIDBook:         s.NextIDBook,
+		NextIDCopy:         s.NextIDCopy,
+		NextIDAuthor:       s.NextIDAuthor,
+		NextIDReservation:  s.NextIDReservation,
+		NextIDLoan:         s.NextIDLoan,
+		NextIDWaitlist:     s.NextIDWaitlist,
+		NextIDFine:         s.NextIDFine,
+		NextIDLedger:       s.NextIDLedger,
+		NextIDPatron:       s.NextIDPatron,
+		NextIDAccount:      s.NextIDAccount,
+		NextIDAPIKey:       s.NextIDAPIKey,
+		NextIDNotification: s.NextIDNotification,
+		NextIDWebhook:      s.NextIDWebhook,
+		NextIDDelivery:     s.NextIDDelivery,
+		JournalSeq:         s.JournalSeq,
+	}
+}
+
+// normalize чинит счётчики ID, которые могли отсутствовать в старом файле.
+func (s *Snapshot) normalize() {
+	if s.Books == nil {
+		s.Books = []*models.Book{}
+	}
+	if s.Copies == nil {
+		s.Copies = []*models.Copy{}
+	}
+	if s.Authors == nil {
+		s.Authors = []*models.Author{}
+	}
+	if s.Reservations == nil {
+		s.Reservations = []*models.Reservation{}
+	}
+	if s.Loans == nil {
+		s.Loans = []*models.Loan{}
+	}
+	if s.Waitlist == nil {
+		s.Waitlist = []*models.WaitlistEntry{}
+	}
+	if s.Fines == nil {
+		s.Fines = []*models.Fine{}
+	}
+	if s.Ledger == nil {
+		s.Ledger = []*models.LedgerEntry{}
+	}
+	if s.Patrons == nil {
+		s.Patrons = []*models.Patron{}
+	}
+	if s.Accounts == nil {
+		s.Accounts = []*models.Account{}
+	}
+	if s.APIKeys == nil {
+		s.APIKeys = []*models.APIKey{}
+	}
+	if s.Notifications == nil {
+		s.Notifications = []*models.EmailNotification{}
+	}
+	if s.Webhooks == nil {
+		s.Webhooks = []*models.Webhook{}
+	}
+	if s.WebhookDeliveries == nil {
+		s.WebhookDeliveries = []*models.WebhookDelivery{}
+	}
+	for _, book := range s.Books {
+		if book.ID >= s.NextIDBook {
+			s.NextIDBook = book.ID + 1
+		}
+	}
+	for _, c := range s.Copies {
+		if c.ID >= s.NextIDCopy {
+			s.NextIDCopy = c.ID + 1
+		}
+	}
+	for _, author := range s.Authors {
+		if author.AuthorID >= s.NextIDAuthor {
+			s.NextIDAuthor = author.AuthorID + 1
+		}
+	}
+	for _, reservation := range s.Reservations {
+		if reservation.ID >= s.NextIDReservation {
+			s.NextIDReservation = reservation.ID + 1
+		}
+	}
+	for _, loan := range s.Loans {
+		if loan.ID >= s.NextIDLoan {
+			s.NextIDLoan = loan.ID + 1
+		}
+	}
+	for _, entry := range s.Waitlist {
+		if entry.ID >= s.NextIDWaitlist {
+			s.NextIDWaitlist = entry.ID + 1
+		}
+	}
+	for _, fine := range s.Fines {
+		if fine.ID >= s.NextIDFine {
+			s.NextIDFine = fine.ID + 1
+		}
+	}
+	for _, entry := range s.Ledger {
+		if entry.ID >= s.NextIDLedger {
+			s.NextIDLedger = entry.ID + 1
+		}
+	}
+	for _, patron := range s.Patrons {
+		if patron.ID >= s.NextIDPatron {
+			s.NextIDPatron = patron.ID + 1
+		}
+		// Файлы до появления настроек уведомлений
+		if patron.Notifications.Channel == "" {
+			patron.Notifications.Channel = models.ChannelEmail
+		}
+		if patron.Notifications.Muted == nil {
+			patron.Notifications.Muted = []string{}
+		}
+	}
+	for _, account := range s.Accounts {
+		if account.ID >= s.NextIDAccount {
+			s.NextIDAccount = account.ID + 1
+		}
+	}
+	for _, key := range s.APIKeys {
+		if key.ID >= s.NextIDAPIKey {
+			s.NextIDAPIKey = key.ID + 1
+		}
+	}
+	for _, notification := range s.Notifications {
+		if notification.ID >= s.NextIDNotification {
+			s.NextIDNotification = notification.ID + 1
+		}
+	}
+	for _, webhook := range s.Webhooks {
+		if webhook.ID >= s.NextIDWebhook {
+			s.NextIDWebhook = webhook.ID + 1
+		}
+	}
+	for _, delivery := range s.WebhookDeliveries {
+		if delivery.ID >= s.NextIDDelivery {
+			s.NextIDDelivery = delivery.ID + 1
+		}
+	}
+}
+
+// addLegacyCopies создаёт по одному экземпляру для книг из файлов, которые
+// появились до учёта экземпляров (в них нет счётчика NextIDCopy).
+func (s *Snapshot) addLegacyCopies() {
+	if s.NextIDCopy != 0 {
+		return
+	}
+	s.NextIDCopy = 1
+	for _, book := range s.Books {
+		status := models.CopyAvailable
+		if !book.IsAvailable {
+			status = models.CopyReserved
+		}
+		c := &models.Copy{
+			BookID:  book.ID,
+			Barcode: models.DefaultBarcode(book.ID, 1),
+			Status:  status,
+		}
+		saveRow(&s.Copies, copyID, &s.NextIDCopy, c)
+
+		for _, reservation := range s.Reservations {
+			if reservation.BookID == book.ID && reservation.Status == "active" {
+				reservation.CopyID = c.ID
+			}
+		}
+	}
+}
+
+func DecodeSnapshot(data []byte) (*Snapshot, error) {
+	s := NewSnapshot()
+	s.NextIDCopy = 0
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("неверный формат снимка: %w", err)
+	}
+
+	// Старые файлы сохраняли ID автора под ключом "AuthorID"
+	var legacy struct {
+		Authors []struct {
+			AuthorID int `json:"AuthorID"`
+		} `json:"Authors"`
+	}
+	if err := json.Unmarshal(data, &legacy); err == nil {
+		for i, author := range s.Authors {
+			if author.AuthorID == 0 && i < len(legacy.Authors) {
+				author.AuthorID = legacy.Authors[i].AuthorID
+			}
+		}
+	}
+
+	s.addLegacyCopies()
+	s.normalize()
+	return s, nil
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewSnapshot(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать %s: %w", path, err)
+	}
+	return DecodeSnapshot(data)
+}
+
+// WriteSnapshot атомарно заменяет файл: пишет во временный файл рядом,
+// делает fsync и переименовывает поверх старого.
+func WriteSnapshot(path string, s *Snapshot) error {
+	data, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("не удалось создать временный файл: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("не удалось заменить %s: %w", path, err)
+	}
+
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
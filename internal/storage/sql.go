@@ -0,0 +1,747 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"library-app/internal/models"
+	"strings"
+)
+
+// SQLStore хранит данные в базе через database/sql. Запросы написаны
+// в диалекте SQLite (плейсхолдеры "?").
+type SQLStore struct {
+	db *sql.DB
+}
+
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db}, nil
+}
+
+func (s *SQLStore) Update(op string, fn func(tx Tx) error) error {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return fmt.Errorf("%s: не удалось начать транзакцию: %w", op, err)
+	}
+
+	if err := fn(&sqlTx{q: tx, seenCopies: map[int]string{}}); err != nil {
+		tx.Rollback()
+		if locked(err) {
+			return fmt.Errorf("%s: %w", op, ErrConflict)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		if locked(err) {
+			return fmt.Errorf("%s: %w", op, ErrConflict)
+		}
+		return fmt.Errorf("%s: не удалось зафиксировать транзакцию: %w", op, err)
+	}
+	return nil
+}
+
+// locked - SQLite отказал в записи, потому что ту же базу меняет другая
+// транзакция (SQLITE_BUSY, SQLITE_LOCKED). Для вызывающего это тот же
+// параллельный конфликт, что и устаревший статус экземпляра в SaveCopy.
+func locked(err error) bool {
+	var coded interface{ Code() int }
+	if !errors.As(err, &coded) {
+		return false
+	}
+	switch coded.Code() & 0xff {
+	case 5, 6:
+		return true
+	}
+	return false
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) read() *sqlTx {
+	return &sqlTx{q: s.db}
+}
+
+func (s *SQLStore) Books() ([]*models.Book, error)        { return s.read().Books() }
+func (s *SQLStore) Book(id int) (*models.Book, error)     { return s.read().Book(id) }
+func (s *SQLStore) Copies() ([]*models.Copy, error)       { return s.read().Copies() }
+func (s *SQLStore) Copy(id int) (*models.Copy, error)     { return s.read().Copy(id) }
+func (s *SQLStore) Authors() ([]*models.Author, error)    { return s.read().Authors() }
+func (s *SQLStore) Author(id int) (*models.Author, error) { return s.read().Author(id) }
+func (s *SQLStore) Reservations() ([]*models.Reservation, error) {
+	return s.read().Reservations()
+}
+func (s *SQLStore) Reservation(id int) (*models.Reservation, error) {
+	return s.read().Reservation(id)
+}
+func (s *SQLStore) Loans() ([]*models.Loan, error)    { return s.read().Loans() }
+func (s *SQLStore) Loan(id int) (*models.Loan, error) { return s.read().Loan(id) }
+func (s *SQLStore) Waitlist() ([]*models.WaitlistEntry, error) {
+	return s.read().Waitlist()
+}
+func (s *SQLStore) Fines() ([]*models.Fine, error)         { return s.read().Fines() }
+func (s *SQLStore) Fine(id int) (*models.Fine, error)      { return s.read().Fine(id) }
+func (s *SQLStore) Ledger() ([]*models.LedgerEntry, error) { return s.read().Ledger() }
+func (s *SQLStore) Patrons() ([]*models.Patron, error)     { return s.read().Patrons() }
+func (s *SQLStore) Patron(id int) (*models.Patron, error)  { return s.read().Patron(id) }
+func (s *SQLStore) Accounts() ([]*models.Account, error)   { return s.read().Accounts() }
+func (s *SQLStore) APIKeys() ([]*models.APIKey, error)     { return s.read().APIKeys() }
+func (s *SQLStore) APIKey(id int) (*models.APIKey, error)  { return s.read().APIKey(id) }
+func (s *SQLStore) Notifications() ([]*models.EmailNotification, error) {
+	return s.read().Notifications()
+}
+func (s *SQLStore) Notification(id int) (*models.EmailNotification, error) {
+	return s.read().Notification(id)
+}
+func (s *SQLStore) Webhooks() ([]*models.Webhook, error) {
+	return s.read().Webhooks()
+}
+func (s *SQLStore) Webhook(id int) (*models.Webhook, error) {
+	return s.read().Webhook(id)
+}
+func (s *SQLStore) WebhookDeliveries() ([]*models.WebhookDelivery, error) {
+	return s.read().WebhookDeliveries()
+}
+func (s *SQLStore) WebhookDelivery(id int) (*models.WebhookDelivery, error) {
+	return s.read().WebhookDelivery(id)
+}
+
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// sqlTx запоминает статусы прочитанных экземпляров, чтобы SaveCopy мог
+// обновить строку только если её не изменили параллельно. Так две реплики
+// не выдадут один и тот же экземпляр.
+type sqlTx struct {
+	q          querier
+	seenCopies map[int]string
+}
+
+func queryRows[T any](q querier, scan func(scanner) (*T, error), query string, args ...any) ([]*T, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []*T{}
+	for rows.Next() {
+		row, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+func queryRow[T any](q querier, scan func(scanner) (*T, error), query string, args ...any) (*T, error) {
+	row, err := scan(q.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return row, err
+}
+
+// insertRow выполняет INSERT и проставляет сгенерированный ID.
+func insertRow(q querier, id *int, query string, args ...any) error {
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	*id = int(newID)
+	return nil
+}
+
+// execAffected выполняет UPDATE/DELETE и возвращает ErrNotFound, если
+// не затронута ни одна строка.
+func execAffected(q querier, query string, args ...any) error {
+	res, err := q.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const bookColumns = `id, title, author_id, year, is_available`
+
+func scanBook(row scanner) (*models.Book, error) {
+	var b models.Book
+	if err := row.Scan(&b.ID, &b.Title, &b.AuthorID, &b.Year, &b.IsAvailable); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (tx *sqlTx) Books() ([]*models.Book, error) {
+	return queryRows(tx.q, scanBook, `SELECT `+bookColumns+` FROM books ORDER BY id`)
+}
+
+func (tx *sqlTx) Book(id int) (*models.Book, error) {
+	return queryRow(tx.q, scanBook, `SELECT `+bookColumns+` FROM books WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveBook(book *models.Book) error {
+	if book.ID == 0 {
+		return insertRow(tx.q, &book.ID,
+			`INSERT INTO books (title, author_id, year, is_available) VALUES (?, ?, ?, ?)`,
+			book.Title, book.AuthorID, book.Year, book.IsAvailable)
+	}
+
+	return execAffected(tx.q,
+		`UPDATE books SET title = ?, author_id = ?, year = ?, is_available = ? WHERE id = ?`,
+		book.Title, book.AuthorID, book.Year, book.IsAvailable, book.ID)
+}
+
+func (tx *sqlTx) DeleteBook(id int) error {
+	return execAffected(tx.q, `DELETE FROM books WHERE id = ?`, id)
+}
+
+const copyColumns = `id, book_id, barcode, branch, location, item_type, status`
+
+func scanCopy(row scanner) (*models.Copy, error) {
+	var c models.Copy
+	if err := row.Scan(&c.ID, &c.BookID, &c.Barcode, &c.Branch, &c.Location, &c.ItemType, &c.Status); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (tx *sqlTx) rememberCopies(copies ...*models.Copy) {
+	if tx.seenCopies == nil {
+		return
+	}
+	for _, c := range copies {
+		tx.seenCopies[c.ID] = c.Status
+	}
+}
+
+func (tx *sqlTx) Copies() ([]*models.Copy, error) {
+	copies, err := queryRows(tx.q, scanCopy, `SELECT `+copyColumns+` FROM copies ORDER BY id`)
+	if err == nil {
+		tx.rememberCopies(copies...)
+	}
+	return copies, err
+}
+
+func (tx *sqlTx) Copy(id int) (*models.Copy, error) {
+	c, err := queryRow(tx.q, scanCopy, `SELECT `+copyColumns+` FROM copies WHERE id = ?`, id)
+	if err == nil {
+		tx.rememberCopies(c)
+	}
+	return c, err
+}
+
+func (tx *sqlTx) SaveCopy(c *models.Copy) error {
+	if c.ID == 0 {
+		return insertRow(tx.q, &c.ID,
+			`INSERT INTO copies (book_id, barcode, branch, location, item_type, status) VALUES (?, ?, ?, ?, ?, ?)`,
+			c.BookID, c.Barcode, c.Branch, c.Location, c.ItemType, c.Status)
+	}
+
+	oldStatus, seen := tx.seenCopies[c.ID]
+	if !seen {
+		return execAffected(tx.q,
+			`UPDATE copies SET book_id = ?, barcode = ?, branch = ?, location = ?, item_type = ?, status = ? WHERE id = ?`,
+			c.BookID, c.Barcode, c.Branch, c.Location, c.ItemType, c.Status, c.ID)
+	}
+
+	err := execAffected(tx.q,
+		`UPDATE copies SET book_id = ?, barcode = ?, branch = ?, location = ?, item_type = ?, status = ?
+		WHERE id = ? AND status = ?`,
+		c.BookID, c.Barcode, c.Branch, c.Location, c.ItemType, c.Status, c.ID, oldStatus)
+	if errors.Is(err, ErrNotFound) {
+		return ErrConflict
+	}
+	if err == nil {
+		tx.seenCopies[c.ID] = c.Status
+	}
+	return err
+}
+
+func (tx *sqlTx) DeleteCopy(id int) error {
+	return execAffected(tx.q, `DELETE FROM copies WHERE id = ?`, id)
+}
+
+const authorColumns = `id, name, email, biography`
+
+func scanAuthor(row scanner) (*models.Author, error) {
+	var a models.Author
+	if err := row.Scan(&a.AuthorID, &a.Name, &a.Email, &a.Biography); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (tx *sqlTx) Authors() ([]*models.Author, error) {
+	return queryRows(tx.q, scanAuthor, `SELECT `+authorColumns+` FROM authors ORDER BY id`)
+}
+
+func (tx *sqlTx) Author(id int) (*models.Author, error) {
+	return queryRow(tx.q, scanAuthor, `SELECT `+authorColumns+` FROM authors WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveAuthor(author *models.Author) error {
+	if author.AuthorID == 0 {
+		return insertRow(tx.q, &author.AuthorID,
+			`INSERT INTO authors (name, email, biography) VALUES (?, ?, ?)`,
+			author.Name, author.Email, author.Biography)
+	}
+	return execAffected(tx.q,
+		`UPDATE authors SET name = ?, email = ?, biography = ? WHERE id = ?`,
+		author.Name, author.Email, author.Biography, author.AuthorID)
+}
+
+const reservationColumns = `id, book_id, copy_id, user_email, start_date, end_date, renewals, status`
+
+func scanReservation(row scanner) (*models.Reservation, error) {
+	var r models.Reservation
+	if err := row.Scan(&r.ID, &r.BookID, &r.CopyID, &r.UserEmail, &r.StartDate, &r.EndDate, &r.Renewals, &r.Status); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (tx *sqlTx) Reservations() ([]*models.Reservation, error) {
+	return queryRows(tx.q, scanReservation, `SELECT `+reservationColumns+` FROM reservations ORDER BY id`)
+}
+
+func (tx *sqlTx) Reservation(id int) (*models.Reservation, error) {
+	return queryRow(tx.q, scanReservation, `SELECT `+reservationColumns+` FROM reservations WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveReservation(r *models.Reservation) error {
+	if r.ID == 0 {
+		return insertRow(tx.q, &r.ID,
+			`INSERT INTO reservations (book_id, copy_id, user_email, start_date, end_date, renewals, status) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			r.BookID, r.CopyID, r.UserEmail, r.StartDate, r.EndDate, r.Renewals, r.Status)
+	}
+	return execAffected(tx.q,
+		`UPDATE reservations SET book_id = ?, copy_id = ?, user_email = ?, start_date = ?, end_date = ?, renewals = ?, status = ? WHERE id = ?`,
+		r.BookID, r.CopyID, r.UserEmail, r.StartDate, r.EndDate, r.Renewals, r.Status, r.ID)
+}
+
+func (tx *sqlTx) DeleteReservation(id int) error {
+	return execAffected(tx.q, `DELETE FROM reservations WHERE id = ?`, id)
+}
+
+const loanColumns = `id, book_id, copy_id, reservation_id, user_email, checkout_date, due_date, return_date, renewals, status, reminded_at`
+
+func scanLoan(row scanner) (*models.Loan, error) {
+	var l models.Loan
+	var returned, reminded sql.NullTime
+	if err := row.Scan(&l.ID, &l.BookID, &l.CopyID, &l.ReservationID, &l.UserEmail,
+		&l.CheckoutDate, &l.DueDate, &returned, &l.Renewals, &l.Status, &reminded); err != nil {
+		return nil, err
+	}
+	if returned.Valid {
+		l.ReturnDate = &returned.Time
+	}
+	if reminded.Valid {
+		l.RemindedAt = &reminded.Time
+	}
+	return &l, nil
+}
+
+func (tx *sqlTx) Loans() ([]*models.Loan, error) {
+	return queryRows(tx.q, scanLoan, `SELECT `+loanColumns+` FROM loans ORDER BY id`)
+}
+
+func (tx *sqlTx) Loan(id int) (*models.Loan, error) {
+	return queryRow(tx.q, scanLoan, `SELECT `+loanColumns+` FROM loans WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveLoan(l *models.Loan) error {
+	var returned, reminded sql.NullTime
+	if l.ReturnDate != nil {
+		returned = sql.NullTime{Time: *l.ReturnDate, Valid: true}
+	}
+	if l.RemindedAt != nil {
+		reminded = sql.NullTime{Time: *l.RemindedAt, Valid: true}
+	}
+
+	if l.ID == 0 {
+		return insertRow(tx.q, &l.ID,
+			`INSERT INTO loans (book_id, copy_id, reservation_id, user_email, checkout_date, due_date, return_date, renewals, status, reminded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			l.BookID, l.CopyID, l.ReservationID, l.UserEmail, l.CheckoutDate, l.DueDate, returned, l.Renewals, l.Status, reminded)
+	}
+	return execAffected(tx.q,
+		`UPDATE loans SET book_id = ?, copy_id = ?, reservation_id = ?, user_email = ?, checkout_date = ?,
+		due_date = ?, return_date = ?, renewals = ?, status = ?, reminded_at = ? WHERE id = ?`,
+		l.BookID, l.CopyID, l.ReservationID, l.UserEmail, l.CheckoutDate, l.DueDate, returned, l.Renewals, l.Status, reminded, l.ID)
+}
+
+const waitlistColumns = `id, book_id, user_email, created_at, status, reservation_id`
+
+func scanWaitlistEntry(row scanner) (*models.WaitlistEntry, error) {
+	var e models.WaitlistEntry
+	if err := row.Scan(&e.ID, &e.BookID, &e.UserEmail, &e.CreatedAt, &e.Status, &e.ReservationID); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (tx *sqlTx) Waitlist() ([]*models.WaitlistEntry, error) {
+	return queryRows(tx.q, scanWaitlistEntry, `SELECT `+waitlistColumns+` FROM waitlist ORDER BY id`)
+}
+
+func (tx *sqlTx) SaveWaitlistEntry(e *models.WaitlistEntry) error {
+	if e.ID == 0 {
+		return insertRow(tx.q, &e.ID,
+			`INSERT INTO waitlist (book_id, user_email, created_at, status, reservation_id) VALUES (?, ?, ?, ?, ?)`,
+			e.BookID, e.UserEmail, e.CreatedAt, e.Status, e.ReservationID)
+	}
+	return execAffected(tx.q,
+		`UPDATE waitlist SET book_id = ?, user_email = ?, created_at = ?, status = ?, reservation_id = ? WHERE id = ?`,
+		e.BookID, e.UserEmail, e.CreatedAt, e.Status, e.ReservationID, e.ID)
+}
+
+const fineColumns = `id, loan_id, user_email, amount, paid, waived, status, created_at, updated_at`
+
+func scanFine(row scanner) (*models.Fine, error) {
+	var f models.Fine
+	if err := row.Scan(&f.ID, &f.LoanID, &f.UserEmail, &f.Amount, &f.Paid, &f.Waived,
+		&f.Status, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func (tx *sqlTx) Fines() ([]*models.Fine, error) {
+	return queryRows(tx.q, scanFine, `SELECT `+fineColumns+` FROM fines ORDER BY id`)
+}
+
+func (tx *sqlTx) Fine(id int) (*models.Fine, error) {
+	return queryRow(tx.q, scanFine, `SELECT `+fineColumns+` FROM fines WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveFine(f *models.Fine) error {
+	if f.ID == 0 {
+		return insertRow(tx.q, &f.ID,
+			`INSERT INTO fines (loan_id, user_email, amount, paid, waived, status, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			f.LoanID, f.UserEmail, f.Amount, f.Paid, f.Waived, f.Status, f.CreatedAt, f.UpdatedAt)
+	}
+	return execAffected(tx.q,
+		`UPDATE fines SET loan_id = ?, user_email = ?, amount = ?, paid = ?, waived = ?, status = ?,
+		created_at = ?, updated_at = ? WHERE id = ?`,
+		f.LoanID, f.UserEmail, f.Amount, f.Paid, f.Waived, f.Status, f.CreatedAt, f.UpdatedAt, f.ID)
+}
+
+const ledgerColumns = `id, fine_id, user_email, type, amount, note, created_at`
+
+func scanLedgerEntry(row scanner) (*models.LedgerEntry, error) {
+	var e models.LedgerEntry
+	if err := row.Scan(&e.ID, &e.FineID, &e.UserEmail, &e.Type, &e.Amount, &e.Note, &e.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (tx *sqlTx) Ledger() ([]*models.LedgerEntry, error) {
+	return queryRows(tx.q, scanLedgerEntry, `SELECT `+ledgerColumns+` FROM ledger ORDER BY id`)
+}
+
+func (tx *sqlTx) AddLedgerEntry(e *models.LedgerEntry) error {
+	return insertRow(tx.q, &e.ID,
+		`INSERT INTO ledger (fine_id, user_email, type, amount, note, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		e.FineID, e.UserEmail, e.Type, e.Amount, e.Note, e.CreatedAt)
+}
+
+const patronColumns = `id, name, email, card_number, phone, address, category, language, status, registered_at, expires_at,
+	notify_muted, notify_channel, quiet_start, quiet_end`
+
+func scanPatron(row scanner) (*models.Patron, error) {
+	var p models.Patron
+	var muted string
+	prefs := &p.Notifications
+	if err := row.Scan(&p.ID, &p.Name, &p.Email, &p.CardNumber, &p.Phone, &p.Address,
+		&p.Category, &p.Language, &p.Status, &p.RegisteredAt, &p.ExpiresAt,
+		&muted, &prefs.Channel, &prefs.QuietStart, &prefs.QuietEnd); err != nil {
+		return nil, err
+	}
+	prefs.Muted = []string{}
+	if muted != "" {
+		prefs.Muted = strings.Split(muted, ",")
+	}
+	return &p, nil
+}
+
+func (tx *sqlTx) Patrons() ([]*models.Patron, error) {
+	return queryRows(tx.q, scanPatron, `SELECT `+patronColumns+` FROM patrons ORDER BY id`)
+}
+
+func (tx *sqlTx) Patron(id int) (*models.Patron, error) {
+	return queryRow(tx.q, scanPatron, `SELECT `+patronColumns+` FROM patrons WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SavePatron(p *models.Patron) error {
+	prefs := p.Notifications
+	muted := strings.Join(prefs.Muted, ",")
+	if prefs.Channel == "" {
+		prefs.Channel = models.ChannelEmail
+	}
+
+	if p.ID == 0 {
+		return insertRow(tx.q, &p.ID,
+			`INSERT INTO patrons (name, email, card_number, phone, address, category, language, status, registered_at, expires_at,
+			notify_muted, notify_channel, quiet_start, quiet_end)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.Name, p.Email, p.CardNumber, p.Phone, p.Address, p.Category, p.Language, p.Status, p.RegisteredAt, p.ExpiresAt,
+			muted, prefs.Channel, prefs.QuietStart, prefs.QuietEnd)
+	}
+	return execAffected(tx.q,
+		`UPDATE patrons SET name = ?, email = ?, card_number = ?, phone = ?, address = ?, category = ?,
+		language = ?, status = ?, registered_at = ?, expires_at = ?,
+		notify_muted = ?, notify_channel = ?, quiet_start = ?, quiet_end = ? WHERE id = ?`,
+		p.Name, p.Email, p.CardNumber, p.Phone, p.Address, p.Category, p.Language, p.Status, p.RegisteredAt, p.ExpiresAt,
+		muted, prefs.Channel, prefs.QuietStart, prefs.QuietEnd, p.ID)
+}
+
+const accountColumns = `id, email, password_hash, role, created_at, updated_at`
+
+func scanAccount(row scanner) (*models.Account, error) {
+	var a models.Account
+	if err := row.Scan(&a.ID, &a.Email, &a.PasswordHash, &a.Role, &a.CreatedAt, &a.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (tx *sqlTx) Accounts() ([]*models.Account, error) {
+	return queryRows(tx.q, scanAccount, `SELECT `+accountColumns+` FROM accounts ORDER BY id`)
+}
+
+func (tx *sqlTx) SaveAccount(a *models.Account) error {
+	if a.ID == 0 {
+		return insertRow(tx.q, &a.ID,
+			`INSERT INTO accounts (email, password_hash, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+			a.Email, a.PasswordHash, a.Role, a.CreatedAt, a.UpdatedAt)
+	}
+	return execAffected(tx.q,
+		`UPDATE accounts SET email = ?, password_hash = ?, role = ?, created_at = ?, updated_at = ? WHERE id = ?`,
+		a.Email, a.PasswordHash, a.Role, a.CreatedAt, a.UpdatedAt, a.ID)
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_by, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var lastUsed, revoked sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.KeyHash, &scopes, &k.CreatedBy,
+		&k.CreatedAt, &lastUsed, &revoked); err != nil {
+		return nil, err
+	}
+	k.Scopes = []string{}
+	if scopes != "" {
+		k.Scopes = strings.Split(scopes, ",")
+	}
+	if lastUsed.Valid {
+		k.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+	return &k, nil
+}
+
+func (tx *sqlTx) APIKeys() ([]*models.APIKey, error) {
+	return queryRows(tx.q, scanAPIKey, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+}
+
+func (tx *sqlTx) APIKey(id int) (*models.APIKey, error) {
+	return queryRow(tx.q, scanAPIKey, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveAPIKey(k *models.APIKey) error {
+	var lastUsed, revoked sql.NullTime
+	if k.LastUsedAt != nil {
+		lastUsed = sql.NullTime{Time: *k.LastUsedAt, Valid: true}
+	}
+	if k.RevokedAt != nil {
+		revoked = sql.NullTime{Time: *k.RevokedAt, Valid: true}
+	}
+	scopes := strings.Join(k.Scopes, ",")
+
+	if k.ID == 0 {
+		return insertRow(tx.q, &k.ID,
+			`INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, created_at, last_used_at, revoked_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			k.Name, k.Prefix, k.KeyHash, scopes, k.CreatedBy, k.CreatedAt, lastUsed, revoked)
+	}
+	return execAffected(tx.q,
+		`UPDATE api_keys SET name = ?, prefix = ?, key_hash = ?, scopes = ?, created_by = ?, created_at = ?,
+		last_used_at = ?, revoked_at = ? WHERE id = ?`,
+		k.Name, k.Prefix, k.KeyHash, scopes, k.CreatedBy, k.CreatedAt, lastUsed, revoked, k.ID)
+}
+
+const notificationColumns = `id, to_email, subject, message, html, status, attempts, last_error, next_attempt_at, queued_at, sent_at, created_at`
+
+func scanNotification(row scanner) (*models.EmailNotification, error) {
+	var n models.EmailNotification
+	var nextAttempt, queued, sent sql.NullTime
+	if err := row.Scan(&n.ID, &n.To, &n.Subject, &n.Message, &n.HTML, &n.Status,
+		&n.Attempts, &n.LastError, &nextAttempt, &queued, &sent, &n.CreatedAt); err != nil {
+		return nil, err
+	}
+	if nextAttempt.Valid {
+		n.NextAttemptAt = &nextAttempt.Time
+	}
+	if queued.Valid {
+		n.QueuedAt = &queued.Time
+	}
+	if sent.Valid {
+		n.SentAt = &sent.Time
+	}
+	return &n, nil
+}
+
+func (tx *sqlTx) Notifications() ([]*models.EmailNotification, error) {
+	return queryRows(tx.q, scanNotification, `SELECT `+notificationColumns+` FROM notifications ORDER BY id`)
+}
+
+func (tx *sqlTx) Notification(id int) (*models.EmailNotification, error) {
+	return queryRow(tx.q, scanNotification, `SELECT `+notificationColumns+` FROM notifications WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveNotification(n *models.EmailNotification) error {
+	var nextAttempt, queued, sent sql.NullTime
+	if n.NextAttemptAt != nil {
+		nextAttempt = sql.NullTime{Time: *n.NextAttemptAt, Valid: true}
+	}
+	if n.QueuedAt != nil {
+		queued = sql.NullTime{Time: *n.QueuedAt, Valid: true}
+	}
+	if n.SentAt != nil {
+		sent = sql.NullTime{Time: *n.SentAt, Valid: true}
+	}
+
+	if n.ID == 0 {
+		return insertRow(tx.q, &n.ID,
+			`INSERT INTO notifications (to_email, subject, message, html, status, attempts, last_error,
+			next_attempt_at, queued_at, sent_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			n.To, n.Subject, n.Message, n.HTML, n.Status, n.Attempts, n.LastError, nextAttempt, queued, sent, n.CreatedAt)
+	}
+	return execAffected(tx.q,
+		`UPDATE notifications SET to_email = ?, subject = ?, message = ?, html = ?, status = ?, attempts = ?,
+		last_error = ?, next_attempt_at = ?, queued_at = ?, sent_at = ?, created_at = ? WHERE id = ?`,
+		n.To, n.Subject, n.Message, n.HTML, n.Status, n.Attempts, n.LastError, nextAttempt, queued, sent, n.CreatedAt, n.ID)
+}
+
+const webhookColumns = `id, url, secret, events, active, created_by, created_at`
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var w models.Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Active, &w.CreatedBy, &w.CreatedAt); err != nil {
+		return nil, err
+	}
+	w.Events = []string{}
+	if events != "" {
+		w.Events = strings.Split(events, ",")
+	}
+	return &w, nil
+}
+
+func (tx *sqlTx) Webhooks() ([]*models.Webhook, error) {
+	return queryRows(tx.q, scanWebhook, `SELECT `+webhookColumns+` FROM webhooks ORDER BY id`)
+}
+
+func (tx *sqlTx) Webhook(id int) (*models.Webhook, error) {
+	return queryRow(tx.q, scanWebhook, `SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveWebhook(w *models.Webhook) error {
+	events := strings.Join(w.Events, ",")
+	if w.ID == 0 {
+		return insertRow(tx.q, &w.ID,
+			`INSERT INTO webhooks (url, secret, events, active, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			w.URL, w.Secret, events, w.Active, w.CreatedBy, w.CreatedAt)
+	}
+	return execAffected(tx.q,
+		`UPDATE webhooks SET url = ?, secret = ?, events = ?, active = ?, created_by = ?, created_at = ? WHERE id = ?`,
+		w.URL, w.Secret, events, w.Active, w.CreatedBy, w.CreatedAt, w.ID)
+}
+
+func (tx *sqlTx) DeleteWebhook(id int) error {
+	// Каскад есть и в схеме, но внешние ключи в SQLite включаются
+	// настройкой соединения
+	if _, err := tx.q.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, id); err != nil {
+		return err
+	}
+	return execAffected(tx.q, `DELETE FROM webhooks WHERE id = ?`, id)
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, response_code, last_error,
+	next_attempt_at, delivered_at, created_at`
+
+func scanDelivery(row scanner) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var nextAttempt, delivered sql.NullTime
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode,
+		&d.LastError, &nextAttempt, &delivered, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	if nextAttempt.Valid {
+		d.NextAttemptAt = &nextAttempt.Time
+	}
+	if delivered.Valid {
+		d.DeliveredAt = &delivered.Time
+	}
+	return &d, nil
+}
+
+func (tx *sqlTx) WebhookDeliveries() ([]*models.WebhookDelivery, error) {
+	return queryRows(tx.q, scanDelivery, `SELECT `+deliveryColumns+` FROM webhook_deliveries ORDER BY id`)
+}
+
+func (tx *sqlTx) WebhookDelivery(id int) (*models.WebhookDelivery, error) {
+	return queryRow(tx.q, scanDelivery, `SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE id = ?`, id)
+}
+
+func (tx *sqlTx) SaveWebhookDelivery(d *models.WebhookDelivery) error {
+	var nextAttempt, delivered sql.NullTime
+	if d.NextAttemptAt != nil {
+		nextAttempt = sql.NullTime{Time: *d.NextAttemptAt, Valid: true}
+	}
+	if d.DeliveredAt != nil {
+		delivered = sql.NullTime{Time: *d.DeliveredAt, Valid: true}
+	}
+
+	if d.ID == 0 {
+		return insertRow(tx.q, &d.ID,
+			`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, response_code, last_error,
+			next_attempt_at, delivered_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, d.ResponseCode, d.LastError, nextAttempt, delivered, d.CreatedAt)
+	}
+	return execAffected(tx.q,
+		`UPDATE webhook_deliveries SET webhook_id = ?, event = ?, payload = ?, status = ?, attempts = ?, response_code = ?,
+		last_error = ?, next_attempt_at = ?, delivered_at = ?, created_at = ? WHERE id = ?`,
+		d.WebhookID, d.Event, d.Payload, d.Status, d.Attempts, d.ResponseCode, d.LastError, nextAttempt, delivered, d.CreatedAt, d.ID)
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"library-app/internal/models"
+	"sync"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// openMemory открывает пустую базу в памяти. У каждого соединения
+// ":memory:" своя база, поэтому соединение одно.
+func openMemory(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newMemorySQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+	store, err := NewSQLStore(openMemory(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestMigrateUpAndRerun(t *testing.T) {
+	db := openMemory(t)
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for run := 1; run <= 2; run++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("запуск %d: %v", run, err)
+		}
+		var count, version int
+		err := db.QueryRow(`SELECT COUNT(*), MAX(version) FROM schema_migrations`).Scan(&count, &version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != len(migrations) || version != migrations[len(migrations)-1].version {
+			t.Fatalf("запуск %d: применено %d миграций до версии %d, ожидалось %d до %d",
+				run, count, version, len(migrations), migrations[len(migrations)-1].version)
+		}
+	}
+}
+
+// sameJSON сравнивает записи по всем полям через JSON.
+func sameJSON(t *testing.T, name string, got, want any) {
+	t.Helper()
+	g, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(g) != string(w) {
+		t.Errorf("%s:\n  прочитано %s\n  записано  %s", name, g, w)
+	}
+}
+
+func TestSQLStoreRoundTrip(t *testing.T) {
+	store := newMemorySQLStore(t)
+	at := time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)
+	later := at.Add(36 * time.Hour)
+
+	author := &models.Author{Person: models.Person{Name: "Антон Чехов", Email: "chekhov@mail.ru"}, Biography: "Писатель"}
+	book := &models.Book{Title: "Чайка", Year: 1896, IsAvailable: true}
+	c := &models.Copy{Barcode: "LIB-1", Branch: "Центральная", Location: "A-1", ItemType: "book", Status: models.CopyAvailable}
+	patron := &models.Patron{
+		Person:     models.Person{Name: "Иван", Email: "reader@example.com"},
+		CardNumber: "C-1", Phone: "+7", Address: "Москва", Category: "adult", Language: "ru",
+		Notifications: models.NotificationPreferences{
+			Muted: []string{"checkout"}, Channel: models.ChannelEmail, QuietStart: "22:00", QuietEnd: "08:00",
+		},
+		Status: models.PatronActive, RegisteredAt: at, ExpiresAt: later,
+	}
+	account := &models.Account{Email: "reader@example.com", PasswordHash: "hash", Role: models.RolePatron, CreatedAt: at, UpdatedAt: later}
+	reservation := &models.Reservation{UserEmail: "reader@example.com", StartDate: at, EndDate: later, Renewals: 1, Status: "active"}
+	loan := &models.Loan{UserEmail: "reader@example.com", CheckoutDate: at, DueDate: later, ReturnDate: &later, RemindedAt: &at, Renewals: 2, Status: models.LoanReturned}
+	entry := &models.WaitlistEntry{UserEmail: "reader@example.com", CreatedAt: at, Status: models.WaitlistWaiting}
+	fine := &models.Fine{UserEmail: "reader@example.com", Amount: 1500, Paid: 500, Status: "open", CreatedAt: at, UpdatedAt: later}
+	ledger := &models.LedgerEntry{UserEmail: "reader@example.com", Type: "charge", Amount: 1500, Note: "просрочка", CreatedAt: at}
+	key := &models.APIKey{Name: "каталог", Prefix: "lib_abc", KeyHash: "h", Scopes: []string{"catalog:read"}, CreatedBy: "admin@example.com", CreatedAt: at, LastUsedAt: &later}
+	notification := &models.EmailNotification{To: "reader@example.com", Subject: "Книга выдана", Message: "текст", HTML: "<p>текст</p>", Status: "retrying", Attempts: 2, LastError: "timeout", NextAttemptAt: &later, QueuedAt: &at, CreatedAt: at}
+	webhook := &models.Webhook{URL: "http://localhost/hook", Secret: "s", Events: []string{models.WebhookBookReturned}, Active: true, CreatedBy: "admin@example.com", CreatedAt: at}
+	delivery := &models.WebhookDelivery{Event: models.WebhookBookReturned, Payload: `{"a":1}`, Status: models.DeliveryDelivered, Attempts: 1, ResponseCode: 200, DeliveredAt: &later, CreatedAt: at}
+
+	err := store.Update("RoundTrip", func(tx Tx) error {
+		if err := tx.SaveAuthor(author); err != nil {
+			return err
+		}
+		book.AuthorID = author.AuthorID
+		if err := tx.SaveBook(book); err != nil {
+			return err
+		}
+		c.BookID = book.ID
+		if err := tx.SaveCopy(c); err != nil {
+			return err
+		}
+		if err := tx.SavePatron(patron); err != nil {
+			return err
+		}
+		if err := tx.SaveAccount(account); err != nil {
+			return err
+		}
+		reservation.BookID, reservation.CopyID = book.ID, c.ID
+		if err := tx.SaveReservation(reservation); err != nil {
+			return err
+		}
+		loan.BookID, loan.CopyID, loan.ReservationID = book.ID, c.ID, reservation.ID
+		if err := tx.SaveLoan(loan); err != nil {
+			return err
+		}
+		entry.BookID, entry.ReservationID = book.ID, reservation.ID
+		if err := tx.SaveWaitlistEntry(entry); err != nil {
+			return err
+		}
+		fine.LoanID = loan.ID
+		if err := tx.SaveFine(fine); err != nil {
+			return err
+		}
+		ledger.FineID = fine.ID
+		if err := tx.AddLedgerEntry(ledger); err != nil {
+			return err
+		}
+		if err := tx.SaveAPIKey(key); err != nil {
+			return err
+		}
+		if err := tx.SaveNotification(notification); err != nil {
+			return err
+		}
+		if err := tx.SaveWebhook(webhook); err != nil {
+			return err
+		}
+		delivery.WebhookID = webhook.ID
+		return tx.SaveWebhookDelivery(delivery)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(name string, want any, load func() (any, error)) {
+		t.Helper()
+		got, err := load()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sameJSON(t, name, got, want)
+	}
+	check("author", author, func() (any, error) { return store.Author(author.AuthorID) })
+	check("book", book, func() (any, error) { return store.Book(book.ID) })
+	check("copy", c, func() (any, error) { return store.Copy(c.ID) })
+	check("patron", patron, func() (any, error) { return store.Patron(patron.ID) })
+	check("accounts", []*models.Account{account}, func() (any, error) { return store.Accounts() })
+	check("reservation", reservation, func() (any, error) { return store.Reservation(reservation.ID) })
+	check("loan", loan, func() (any, error) { return store.Loan(loan.ID) })
+	check("waitlist", []*models.WaitlistEntry{entry}, func() (any, error) { return store.Waitlist() })
+	check("fine", fine, func() (any, error) { return store.Fine(fine.ID) })
+	check("ledger", []*models.LedgerEntry{ledger}, func() (any, error) { return store.Ledger() })
+	check("api key", key, func() (any, error) { return store.APIKey(key.ID) })
+	check("notification", notification, func() (any, error) { return store.Notification(notification.ID) })
+	check("webhook", webhook, func() (any, error) { return store.Webhook(webhook.ID) })
+	check("delivery", delivery, func() (any, error) { return store.WebhookDelivery(delivery.ID) })
+
+	err = store.Update("Delete", func(tx Tx) error {
+		if err := tx.DeleteReservation(reservation.ID); err != nil {
+			return err
+		}
+		return tx.DeleteWebhook(webhook.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reservation(reservation.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("бронь после удаления: %v, ожидалось ErrNotFound", err)
+	}
+	if _, err := store.WebhookDelivery(delivery.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("доставка после удаления подписки: %v, ожидалось ErrNotFound", err)
+	}
+}
+
+// reserveCopy повторяет ReserveBook на уровне хранилища: читает экземпляр,
+// ждёт, пока его прочитает и вторая транзакция, и бронирует.
+func reserveCopy(store *SQLStore, copyID int, read chan<- struct{}, proceed <-chan struct{}) error {
+	return store.Update("ReserveBook", func(tx Tx) error {
+		c, err := tx.Copy(copyID)
+		if err != nil {
+			return err
+		}
+		read <- struct{}{}
+		<-proceed
+
+		if c.Status != models.CopyAvailable {
+			return errors.New("экземпляр уже занят")
+		}
+		err = tx.SaveReservation(&models.Reservation{
+			BookID: c.BookID, CopyID: c.ID, UserEmail: "reader@example.com", Status: "active",
+		})
+		if err != nil {
+			return err
+		}
+		c.Status = models.CopyReserved
+		return tx.SaveCopy(c)
+	})
+}
+
+func TestConcurrentReserveConflict(t *testing.T) {
+	// Две реплики API с одной базой: общая база в памяти, у каждой
+	// реплики своё подключение
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared&_pragma=foreign_keys(1)"
+	var stores []*SQLStore
+	for range 2 {
+		db, err := sql.Open("sqlite", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.SetMaxOpenConns(1)
+		t.Cleanup(func() { db.Close() })
+		store, err := NewSQLStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores = append(stores, store)
+	}
+
+	c := &models.Copy{Barcode: "LIB-1", ItemType: "book", Status: models.CopyAvailable}
+	err := stores[0].Update("Seed", func(tx Tx) error {
+		author := &models.Author{Person: models.Person{Name: "Автор"}}
+		if err := tx.SaveAuthor(author); err != nil {
+			return err
+		}
+		book := &models.Book{Title: "Книга", AuthorID: author.AuthorID, IsAvailable: true}
+		if err := tx.SaveBook(book); err != nil {
+			return err
+		}
+		c.BookID = book.ID
+		return tx.SaveCopy(c)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := make(chan struct{}, len(stores))
+	proceed := make(chan struct{})
+	errs := make([]error, len(stores))
+	var wg sync.WaitGroup
+	for i, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = reserveCopy(store, c.ID, read, proceed)
+		}()
+	}
+	for range stores {
+		<-read
+	}
+	close(proceed)
+	wg.Wait()
+
+	var ok, conflicts int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrConflict):
+			conflicts++
+		default:
+			t.Errorf("неожиданная ошибка: %v", err)
+		}
+	}
+	if ok != 1 || conflicts != 1 {
+		t.Fatalf("успешных броней %d, конфликтов %d, ожидалось по одной: %v", ok, conflicts, errs)
+	}
+
+	saved, err := stores[1].Copy(c.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reservations, err := stores[1].Reservations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != models.CopyReserved || len(reservations) != 1 {
+		t.Fatalf("экземпляр %s, броней %d, ожидалось reserved и одна бронь", saved.Status, len(reservations))
+	}
+}
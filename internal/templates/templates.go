@@ -0,0 +1,253 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// События, о которых сообщают письма.
+const (
+	EventCheckout           = "checkout"
+	EventReturn             = "return"
+	EventHoldAvailable      = "hold_available"
+	EventReservationExpired = "reservation_expired"
+	EventDueSoon            = "due_soon"
+)
+
+var Events = []string{EventCheckout, EventReturn, EventHoldAvailable, EventReservationExpired, EventDueSoon}
+
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	LangRU = "ru"
+	LangEN = "en"
+	// DefaultLang - язык писем, если читатель его не выбрал
+	DefaultLang = LangRU
+)
+
+var Languages = []string{LangRU, LangEN}
+
+func ValidLanguage(lang string) bool {
+	for _, l := range Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+//go:embed defaults
+var defaults embed.FS
+
+// Data - данные для шаблонов. Date - срок, о котором идёт речь
+// в письме: дата возврата или окончания брони. UnsubscribeURL - ссылка
+// для отписки от писем этого типа без входа в систему.
+type Data struct {
+	Name           string
+	Book           string
+	Author         string
+	ReservationID  int
+	Date           time.Time
+	UnsubscribeURL string
+}
+
+// Message - готовое письмо.
+type Message struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+type eventTemplates struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Set - шаблоны писем по языкам и событиям. Шаблон события - файл
+// <язык>/<событие>.txt с блоком {{define "subject"}} и текстом письма
+// и необязательный <язык>/<событие>.html. Файлы из папки dir заменяют
+// встроенные.
+type Set struct {
+	mu        sync.RWMutex
+	dir       string
+	templates map[string]map[string]eventTemplates
+}
+
+// Load загружает встроенные шаблоны и шаблоны из dir (если папка есть).
+func Load(dir string) (*Set, error) {
+	s := &Set{dir: dir}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Default - только встроенные шаблоны.
+func Default() *Set {
+	s, err := Load("")
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Reload перечитывает шаблоны. При ошибке остаются прежние.
+func (s *Set) Reload() error {
+	sources := []fs.FS{mustSub(defaults, "defaults")}
+	if s.dir != "" {
+		if info, err := os.Stat(s.dir); err == nil && info.IsDir() {
+			sources = append(sources, os.DirFS(s.dir))
+		}
+	}
+
+	loaded := map[string]map[string]eventTemplates{}
+	for _, lang := range Languages {
+		loaded[lang] = map[string]eventTemplates{}
+		for _, event := range Events {
+			t, err := parseEvent(sources, lang, event)
+			if err != nil {
+				return err
+			}
+			// Ошибки вроде неизвестного поля видны только при выполнении
+			if _, err := t.render(Sample(time.Now())); err != nil {
+				return fmt.Errorf("шаблон %s/%s: %w", lang, event, err)
+			}
+			loaded[lang][event] = t
+		}
+	}
+
+	s.mu.Lock()
+	s.templates = loaded
+	s.mu.Unlock()
+	return nil
+}
+
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// readLast читает файл из последнего источника, где он есть.
+func readLast(sources []fs.FS, name string) (string, bool, error) {
+	for i := len(sources) - 1; i >= 0; i-- {
+		data, err := fs.ReadFile(sources[i], name)
+		if err == nil {
+			return string(data), true, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", false, err
+		}
+	}
+	return "", false, nil
+}
+
+func parseEvent(sources []fs.FS, lang, event string) (eventTemplates, error) {
+	funcs := funcMap(lang)
+	var t eventTemplates
+
+	name := path.Join(lang, event+".txt")
+	text, ok, err := readLast(sources, name)
+	if err != nil {
+		return t, err
+	}
+	if !ok {
+		return t, fmt.Errorf("нет шаблона %s", name)
+	}
+	t.text, err = texttemplate.New(name).Funcs(texttemplate.FuncMap(funcs)).Parse(text)
+	if err != nil {
+		return t, fmt.Errorf("шаблон %s: %w", name, err)
+	}
+	if t.text.Lookup("subject") == nil {
+		return t, fmt.Errorf("шаблон %s: нет блока {{define \"subject\"}}", name)
+	}
+
+	name = path.Join(lang, event+".html")
+	html, ok, err := readLast(sources, name)
+	if err != nil || !ok {
+		return t, err
+	}
+	t.html, err = htmltemplate.New(name).Funcs(htmltemplate.FuncMap(funcs)).Parse(html)
+	if err != nil {
+		return t, fmt.Errorf("шаблон %s: %w", name, err)
+	}
+	return t, nil
+}
+
+func funcMap(lang string) map[string]any {
+	layout := "02.01.2006 15:04"
+	if lang == LangEN {
+		layout = "Jan 2, 2006 15:04"
+	}
+	return map[string]any{
+		"date": func(t time.Time) string { return t.Format(layout) },
+	}
+}
+
+// Render собирает письмо о событии на языке lang (или языке по умолчанию,
+// если lang не поддерживается).
+func (s *Set) Render(event, lang string, data Data) (Message, error) {
+	if !ValidLanguage(lang) {
+		lang = DefaultLang
+	}
+
+	s.mu.RLock()
+	t, ok := s.templates[lang][event]
+	s.mu.RUnlock()
+	if !ok {
+		return Message{}, fmt.Errorf("неизвестное событие %q", event)
+	}
+
+	return t.render(data)
+}
+
+func (t eventTemplates) render(data Data) (Message, error) {
+	var subject, text, html bytes.Buffer
+	if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if t.html != nil {
+		if err := t.html.Execute(&html, data); err != nil {
+			return Message{}, err
+		}
+	}
+	return Message{
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    html.String(),
+	}, nil
+}
+
+// Sample - пример данных для предпросмотра шаблонов.
+func Sample(now time.Time) Data {
+	return Data{
+		Name:           "Иван Петров",
+		Book:           "Война и мир",
+		Author:         "Лев Толстой",
+		ReservationID:  42,
+		Date:           now.AddDate(0, 0, 14),
+		UnsubscribeURL: "http://localhost:8080/unsubscribe?token=sample",
+	}
+}
@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки запроса с событием. Подпись - "sha256=" и hex от
+// HMAC-SHA256(secret, timestamp + "." + тело): метка времени в подписи
+// не даёт повторить старый запрос.
+const (
+	HeaderEvent     = "X-Library-Event"
+	HeaderDelivery  = "X-Library-Delivery"
+	HeaderTimestamp = "X-Library-Timestamp"
+	HeaderSignature = "X-Library-Signature"
+)
+
+var (
+	ErrBadSignature = errors.New("неверная подпись вебхука")
+	ErrStale        = errors.New("устаревшая метка времени вебхука")
+)
+
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись запроса на стороне получателя. tolerance -
+// насколько метка времени может отличаться от now, 0 - не проверять.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return ErrBadSignature
+	}
+	if tolerance > 0 && now.Sub(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return ErrStale
+	}
+	return nil
+}
+
+// Request - одна попытка доставки события.
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID int
+	Payload    []byte
+}
+
+// StatusError - получатель ответил не 2xx. Повторять имеет смысл только
+// ответы 5xx, 408 и 429, остальные означают, что запрос отклонён.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("получатель ответил %d", e.Code)
+	}
+	return fmt.Sprintf("получатель ответил %d: %s", e.Code, e.Body)
+}
+
+func (e *StatusError) Permanent() bool {
+	return e.Code < 500 && e.Code != http.StatusRequestTimeout && e.Code != http.StatusTooManyRequests
+}
+
+// IsPermanent сообщает, что повтор доставки не поможет.
+func IsPermanent(err error) bool {
+	var status *StatusError
+	return errors.As(err, &status) && status.Permanent()
+}
+
+type Client struct {
+	HTTP *http.Client
+}
+
+func NewClient(timeout time.Duration) *Client {
+	return &Client{HTTP: &http.Client{
+		Timeout: timeout,
+		// Перенаправления не выполняются: подписанное тело ушло бы
+		// по адресу, которого нет в подписке
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Deliver отправляет событие POST-запросом и возвращает код ответа
+// (0, если ответа не было).
+func (c *Client) Deliver(ctx context.Context, r Request, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(r.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "library-app-webhooks")
+	req.Header.Set(HeaderEvent, r.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(r.DeliveryID))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(r.Secret, timestamp, r.Payload))
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("запрос к %s не удался: %w", r.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return resp.StatusCode, &StatusError{Code: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+}
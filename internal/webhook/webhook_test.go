@@ -0,0 +1,28 @@
+package webhook
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":"ping"}`)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, "1")
+	header.Set(HeaderSignature, Sign("topsecret", 1, body))
+
+	if err := Verify("topsecret", header, body, 0, now); err != nil {
+		t.Fatalf("верная подпись отклонена: %v", err)
+	}
+	if err := Verify("other", header, body, 0, now); err != ErrBadSignature {
+		t.Errorf("чужой секрет: %v", err)
+	}
+	if err := Verify("topsecret", header, []byte(`{"event":"pong"}`), 0, now); err != ErrBadSignature {
+		t.Errorf("изменённое тело: %v", err)
+	}
+	if err := Verify("topsecret", header, body, time.Minute, now); err != ErrStale {
+		t.Errorf("старая метка времени: %v", err)
+	}
+}